@@ -0,0 +1,149 @@
+package circuits
+
+import (
+	"github.com/brevis-network/brevis-sdk/sdk"
+)
+
+// NewAggregateCircuit returns a circuit assignment with its custom inputs set to p
+func NewAggregateCircuit(p Params) *AggregateCircuit {
+	return &AggregateCircuit{
+		Token1Addr: sdk.ConstUint248(p.Token1Addr),
+		Token2Addr: sdk.ConstUint248(p.Token2Addr),
+		MinVolume:  sdk.ConstUint248(p.MinVolume),
+
+		Token1Decimals: sdk.ConstUint248(p.Token1Decimals),
+		Token2Decimals: sdk.ConstUint248(p.Token2Decimals),
+	}
+}
+
+// AggregateCircuit proves the combined result of up to 32 trades of one
+// account. Every receipt is a Transfer out of the account: transfers of token 1
+// are buys and transfers of token 2 are sells. Receipt 0 is the first leg and
+// receipts must be ordered by block, transaction and log position. Legs and
+// totals are normalized to NormalizedDecimals; unlike AppCircuit, the two
+// tokens are not priced against each other.
+type AggregateCircuit struct {
+	// Token spent on buys
+	Token1Addr sdk.Uint248
+	// Token spent on sells
+	Token2Addr sdk.Uint248
+	// Minimum value of every leg in token 1 units, compared with legs of
+	// token 2 after normalizing their decimals
+	MinVolume sdk.Uint248
+	// Decimals of token 1 and token 2
+	Token1Decimals sdk.Uint248
+	Token2Decimals sdk.Uint248
+}
+
+var _ sdk.AppCircuit = &AggregateCircuit{}
+
+// OutputSchema returns the layout of the circuit's output
+func (c *AggregateCircuit) OutputSchema() OutputSchema {
+	return OutputSchema{
+		Name: "AggregatePnl",
+		Fields: []OutputField{
+			addressField("account"),
+			uintField("totalVolume", 248),
+			uintField("pnlAmount", 248),
+			boolField("isProfit"),
+			uintField("tradeCount", 32),
+			uintField("firstBlock", 64),
+			uintField("lastBlock", 64),
+			addressField("token1"),
+			addressField("token2"),
+			uintField("minVolume", 248),
+			uintField("token1Decimals", 8),
+			uintField("token2Decimals", 8),
+		},
+	}
+}
+
+func (c *AggregateCircuit) Allocate() (maxReceipts, maxStorage, maxTransactions int) {
+	return 32, 0, 0
+}
+
+func (c *AggregateCircuit) Define(api *sdk.CircuitAPI, in sdk.DataInput) error {
+	u := api.Uint248
+	receipts := sdk.NewDataStream(api, in.Receipts)
+
+	// All legs belong to the account of the first one. Receipt 0 must be on,
+	// so the account is taken from a verified leg and the stream is not empty.
+	u.AssertIsEqual(sdk.Uint248{Val: in.Receipts.Toggles[0]}, sdk.ConstUint248(1))
+	account := api.ToUint248(sdk.GetUnderlying(receipts, 0).Fields[0].Value)
+
+	isBuy := func(r sdk.Receipt) sdk.Uint248 {
+		return u.IsEqual(r.Fields[0].Contract, c.Token1Addr)
+	}
+	isSell := func(r sdk.Receipt) sdk.Uint248 {
+		return u.IsEqual(r.Fields[0].Contract, c.Token2Addr)
+	}
+	scale1 := decimalsScale(api, c.Token1Decimals)
+	scale2 := decimalsScale(api, c.Token2Decimals)
+	// Legs are compared with the minimum volume in NormalizedDecimals
+	minVolume := normalize(api, c.MinVolume, scale1)
+	legVolume := func(r sdk.Receipt) sdk.Uint248 {
+		return normalize(api, api.ToUint248(r.Fields[1].Value), u.Select(isBuy(r), scale1, scale2))
+	}
+
+	// Verify every leg is a Transfer of token 1 or token 2 out of the account
+	sdk.AssertEach(receipts, func(r sdk.Receipt) sdk.Uint248 {
+		return u.And(
+			u.Or(isBuy(r), isSell(r)),
+			u.IsEqual(r.Fields[1].Contract, r.Fields[0].Contract),
+			u.IsEqual(r.Fields[0].EventID, TransferEventID),
+			u.IsEqual(r.Fields[1].EventID, TransferEventID),
+			u.IsEqual(r.Fields[0].IsTopic, sdk.ConstUint248(1)),
+			u.IsEqual(r.Fields[0].Index, sdk.ConstUint248(1)),
+			u.IsEqual(r.Fields[1].IsTopic, sdk.ConstUint248(0)),
+			u.IsEqual(r.Fields[1].Index, sdk.ConstUint248(0)),
+			u.IsEqual(api.ToUint248(r.Fields[0].LogPos), api.ToUint248(r.Fields[1].LogPos)),
+			u.IsEqual(api.ToUint248(r.Fields[0].Value), account),
+			u.Not(u.IsLessThan(legVolume(r), minVolume)),
+		)
+	})
+
+	// Strict ordering makes sure no leg is counted twice
+	sdk.AssertSorted(receipts, func(a, b sdk.Receipt) sdk.Uint248 {
+		return u.IsLessThan(logOrder(api, a), logOrder(api, b))
+	})
+
+	legValue := func(isSide func(sdk.Receipt) sdk.Uint248) sdk.MapFunc[sdk.Receipt, sdk.Uint248] {
+		return func(r sdk.Receipt) sdk.Uint248 {
+			return u.Select(isSide(r), api.ToUint248(r.Fields[1].Value), sdk.ConstUint248(0))
+		}
+	}
+	totalBuy := normalize(api, sdk.Sum(sdk.Map(receipts, legValue(isBuy))), scale1)
+	totalSell := normalize(api, sdk.Sum(sdk.Map(receipts, legValue(isSell))), scale2)
+	totalVolume := u.Add(totalBuy, totalSell)
+
+	// Realized PnL as a sign bit and a magnitude, as in AppCircuit
+	isLoss := u.IsLessThan(totalSell, totalBuy)
+	isProfit := u.Not(isLoss)
+	pnlAmount := u.Select(isLoss, u.Sub(totalBuy, totalSell), u.Sub(totalSell, totalBuy))
+
+	blockNums := sdk.Map(receipts, func(r sdk.Receipt) sdk.Uint248 {
+		return api.ToUint248(r.BlockNum)
+	})
+	firstBlock := sdk.Min(blockNums)
+	lastBlock := sdk.Max(blockNums)
+
+	// Output results
+	out := newOutputWriter(api, c.OutputSchema())
+	out.Address("account", account)
+	out.Uint("totalVolume", 248, totalVolume)
+	out.Uint("pnlAmount", 248, pnlAmount)
+	out.Bool("isProfit", isProfit)
+	out.Uint("tradeCount", 32, sdk.Count(receipts))
+	out.Uint("firstBlock", 64, firstBlock)
+	out.Uint("lastBlock", 64, lastBlock)
+
+	// Commit to the custom inputs so verifiers can check which pair and
+	// threshold the proof was generated for
+	out.Address("token1", c.Token1Addr)
+	out.Address("token2", c.Token2Addr)
+	out.Uint("minVolume", 248, c.MinVolume)
+	out.Uint("token1Decimals", 8, c.Token1Decimals)
+	out.Uint("token2Decimals", 8, c.Token2Decimals)
+
+	return out.Done()
+}
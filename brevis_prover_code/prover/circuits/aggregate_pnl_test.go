@@ -0,0 +1,77 @@
+package circuits
+
+import (
+	"math/big"
+	"testing"
+
+	"prover/outputs"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestAggregateCircuit(t *testing.T) {
+	receipts := loadReceipts(t)
+	tx := func(n byte) sdk.ReceiptData {
+		r := receipts[common.BigToHash(big.NewInt(int64(n)))]
+		// 0xa1 sends USDC in log 1, the other receipts send USDT in log 0
+		if n == 0xa1 {
+			return r.transferData(t, 1)
+		}
+		return r.transferData(t, 0)
+	}
+
+	// The account buys with 1000 USDC in 0xa1, sells 1050 USDT in 0xa2 and
+	// 900 USDT in 0xa3
+	out, err := prove(t, &AggregateCircuit{}, NewAggregateCircuit(DefaultParams()), outputs.DecodeAggregatePnlOutput, tx(0xa1), tx(0xa2), tx(0xa3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Account != common.HexToAddress("0x1111111111111111111111111111111111111111") ||
+		out.TotalVolume.Cmp(wholeTokens(2950)) != 0 || out.PnlAmount.Cmp(wholeTokens(950)) != 0 || !out.IsProfit ||
+		out.TradeCount != 3 || out.FirstBlock != 19000000 || out.LastBlock != 19000200 {
+		t.Errorf("unexpected output %+v", out)
+	}
+
+	// Unlike AppCircuit, legs may start with a sell
+	if out, err = prove(t, &AggregateCircuit{}, NewAggregateCircuit(DefaultParams()), outputs.DecodeAggregatePnlOutput, tx(0xa7), tx(0xa1)); err != nil {
+		t.Fatal(err)
+	}
+	if out.PnlAmount.Cmp(wholeTokens(50)) != 0 || !out.IsProfit || out.FirstBlock != 18999900 || out.LastBlock != 19000000 {
+		t.Errorf("unexpected output %+v", out)
+	}
+
+	for name, legs := range map[string][]sdk.ReceiptData{
+		"out of order":     {tx(0xa2), tx(0xa1)},
+		"same leg twice":   {tx(0xa1), tx(0xa1)},
+		"wrong token":      {tx(0xa1), tx(0xa4)},
+		"wrong account":    {tx(0xa1), tx(0xa5)},
+		"below min volume": {tx(0xa1), tx(0xa6)},
+		"not a transfer":   {tx(0xa1), tx(0xa8)},
+		"no first leg":     {{}, tx(0xa1), tx(0xa2)},
+	} {
+		if _, err = prove(t, &AggregateCircuit{}, NewAggregateCircuit(DefaultParams()), outputs.DecodeAggregatePnlOutput, legs...); err == nil {
+			t.Errorf("%s: expected the circuit to reject the receipts", name)
+		}
+	}
+
+	// With WETH as token 1 the minimum volume is in WETH. The account buys with
+	// 1.1 WETH in 0xb3 and sells 3000 USDC in 0xb7, which only compare after
+	// normalizing their decimals.
+	wethUsdc := DefaultParams()
+	wethUsdc.Token1Addr, wethUsdc.Token2Addr = common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2"), wethUsdc.Token1Addr
+	wethUsdc.Token1Decimals, wethUsdc.Token2Decimals = 18, 6
+	wethUsdc.MinVolume = wholeTokens(1)
+	legs := []sdk.ReceiptData{tx(0xb3), tx(0xb7)}
+	if out, err = prove(t, &AggregateCircuit{}, NewAggregateCircuit(wethUsdc), outputs.DecodeAggregatePnlOutput, legs...); err != nil {
+		t.Fatal(err)
+	}
+	buy := new(big.Int).Div(wholeTokens(11), big.NewInt(10))
+	if out.TotalVolume.Cmp(new(big.Int).Add(wholeTokens(3000), buy)) != 0 || out.PnlAmount.Cmp(new(big.Int).Sub(wholeTokens(3000), buy)) != 0 || !out.IsProfit {
+		t.Errorf("unexpected output %+v", out)
+	}
+	wethUsdc.MinVolume = new(big.Int).Div(wholeTokens(12), big.NewInt(10))
+	if _, err = prove(t, &AggregateCircuit{}, NewAggregateCircuit(wethUsdc), outputs.DecodeAggregatePnlOutput, legs...); err == nil {
+		t.Error("expected the circuit to reject a buy below the minimum volume")
+	}
+}
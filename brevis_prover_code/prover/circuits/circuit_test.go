@@ -1,53 +1,171 @@
 package circuits
 
 import (
+	"math/big"
 	"testing"
 
+	"prover/outputs"
+
 	"github.com/brevis-network/brevis-sdk/sdk"
-	"github.com/brevis-network/brevis-sdk/test"
 	"github.com/ethereum/go-ethereum/common"
 )
 
 func TestCircuit(t *testing.T) {
-	rpc := "RPC_URL"
-	localDir := "$HOME/circuitOut/myBrevisApp"
-	app, err := sdk.NewBrevisApp(1, rpc, localDir)
-	check(err)
-
-	txHash := common.HexToHash(
-		"0x8a7fc50330533cd0adbf71e1cfb51b1b6bbe2170b4ce65c02678cf08c8b17737")
-
-	app.AddReceipt(sdk.ReceiptData{
-		TxHash: txHash,
-		Fields: []sdk.LogFieldData{
-			{
-				IsTopic:    true,
-				LogPos:     0,
-				FieldIndex: 1,
-			},
-			{
-				IsTopic:    false,
-				LogPos:     0,
-				FieldIndex: 0,
-			},
-		},
-	})
-
-	appCircuit := &AppCircuit{}
-	appCircuitAssignment := &AppCircuit{}
-
-	circuitInput, err := app.BuildCircuitInput(appCircuit)
-	check(err)
-
-	///////////////////////////////////////////////////////////////////////////////
-	// Testing
-	///////////////////////////////////////////////////////////////////////////////
-
-	test.ProverSucceeded(t, appCircuit, appCircuitAssignment, circuitInput)
+	receipts := loadReceipts(t)
+	tx := func(n byte) recordedReceipt {
+		return receipts[common.BigToHash(big.NewInt(int64(n)))]
+	}
+
+	// The buy is the USDC Transfer out of the account in log 1 of tx 0xa1.
+	// Amounts are normalized to 18 decimals.
+	buy := tx(0xa1).transferData(t, 1)
+	cases := []struct {
+		name string
+		sell sdk.ReceiptData
+		// Expected PnL, nil if the receipts must be rejected
+		pnl      *big.Int
+		isProfit bool
+	}{
+		{"profit", tx(0xa2).transferData(t, 0), wholeTokens(50), true},
+		{"loss", tx(0xa3).transferData(t, 0), wholeTokens(100), false},
+		{"wrong token", tx(0xa4).transferData(t, 0), nil, false},
+		{"wrong account", tx(0xa5).transferData(t, 0), nil, false},
+		{"below minimum volume", tx(0xa6).transferData(t, 0), nil, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out, err := prove(t, &AppCircuit{}, NewAppCircuit(DefaultParams()), outputs.DecodeProfitTrackingOutput, buy, c.sell)
+			if c.pnl == nil {
+				if err == nil {
+					t.Fatal("expected the circuit to reject the receipts")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.PnlAmount.Cmp(c.pnl) != 0 || out.IsProfit != c.isProfit {
+				t.Errorf("PnL is %s (profit %t), expected %s (profit %t)", out.PnlAmount, out.IsProfit, c.pnl, c.isProfit)
+			}
+			if out.BuyBlockNum != buy.BlockNum.Uint64() || out.SellBlockNum != c.sell.BlockNum.Uint64() {
+				t.Errorf("blocks are %d and %d", out.BuyBlockNum, out.SellBlockNum)
+			}
+		})
+	}
 }
 
-func check(err error) {
+func TestCircuitRejectsMisorderedLegs(t *testing.T) {
+	receipts := loadReceipts(t)
+	tx := func(n byte) recordedReceipt {
+		return receipts[common.BigToHash(big.NewInt(int64(n)))]
+	}
+	buy := tx(0xa1).transferData(t, 1)
+
+	// A pair of one token lets the buy log pass as the sell, so only the
+	// ordering rejects it
+	sameToken := DefaultParams()
+	sameToken.Token2Addr = sameToken.Token1Addr
+	sameToken.Token2Decimals = sameToken.Token1Decimals
+
+	cases := []struct {
+		name   string
+		params Params
+		sell   sdk.ReceiptData
+	}{
+		// 0xa7 sells USDT a block before the buy
+		{"sell before buy", DefaultParams(), tx(0xa7).transferData(t, 0)},
+		{"sell is the buy log", sameToken, buy},
+		// 0xa8 is an Approval with the fields of a Transfer
+		{"not a transfer", DefaultParams(), tx(0xa8).transferData(t, 0)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := prove(t, &AppCircuit{}, NewAppCircuit(c.params), outputs.DecodeProfitTrackingOutput, buy, c.sell); err == nil {
+				t.Fatal("expected the circuit to reject the receipts")
+			}
+		})
+	}
+}
+
+func TestCircuitPricing(t *testing.T) {
+	receipts := loadReceipts(t)
+	tx := func(n byte) recordedReceipt {
+		return receipts[common.BigToHash(big.NewInt(int64(n)))]
+	}
+
+	// The account buys with 2500 USDC in 0xb1 and sells 1.1 WETH in 0xb3. The
+	// Swap in 0xb2, earlier in the sell's block, prices WETH at 2500 USDC.
+	weth := common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2")
+	params := DefaultParams()
+	params.Token2Addr = weth
+	params.Token2Decimals = 18
+	params.PoolManager = common.HexToAddress("0x000000000004444c5dc75cB358380D2e3dE08A90")
+	params.PoolId = common.HexToHash("0x7777777777777777777777777777777777777777777777777777777777777777")
+	buy := tx(0xb1).transferData(t, 0)
+	sell := tx(0xb3).transferData(t, 0)
+
+	out, err := prove(t, &AppCircuit{}, NewAppCircuit(params), outputs.DecodeProfitTrackingOutput, buy, sell, tx(0xb2).swapData(t, 0))
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
+	}
+	sqrtPrice := new(big.Int).Lsh(big.NewInt(20000), 96)
+	if out.PnlAmount.Cmp(wholeTokens(250)) != 0 || !out.IsProfit || out.SqrtPriceX96.Cmp(sqrtPrice) != 0 || out.SwapBlockNum != 19001010 {
+		t.Errorf("unexpected output %+v", out)
+	}
+
+	// Without a pool, 1.1 WETH and 2500 USDC only compare after normalizing
+	// their decimals, so the sell is worth 1.1 USDC
+	unpriced := params
+	unpriced.PoolManager = common.Address{}
+	unpriced.PoolId = common.Hash{}
+	unpriced.MinVolume = big.NewInt(1_000_000)
+	if out, err = prove(t, &AppCircuit{}, NewAppCircuit(unpriced), outputs.DecodeProfitTrackingOutput, buy, sell); err != nil {
+		t.Fatal(err)
+	}
+	loss := new(big.Int).Sub(wholeTokens(2500), new(big.Int).Div(wholeTokens(11), big.NewInt(10)))
+	if out.PnlAmount.Cmp(loss) != 0 || out.IsProfit || out.SqrtPriceX96.Sign() != 0 || out.SwapBlockNum != 0 {
+		t.Errorf("unexpected output %+v", out)
+	}
+
+	// With WETH as token 1 the minimum volume is in WETH, and the USDC sell is
+	// valued in WETH at the pool price: 3000 USDC in 0xb7 are worth 1.2 WETH
+	// and 2000 USDC in 0xb8 0.8 WETH
+	wethUsdc := params
+	wethUsdc.Token1Addr, wethUsdc.Token2Addr = weth, params.Token1Addr
+	wethUsdc.Token1Decimals, wethUsdc.Token2Decimals = 18, 6
+	wethUsdc.MinVolume = wholeTokens(1)
+	if out, err = prove(t, &AppCircuit{}, NewAppCircuit(wethUsdc), outputs.DecodeProfitTrackingOutput, sell, tx(0xb7).transferData(t, 0), tx(0xb2).swapData(t, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if out.PnlAmount.Cmp(new(big.Int).Div(wholeTokens(1), big.NewInt(10))) != 0 || !out.IsProfit || out.SwapBlockNum != 19001010 {
+		t.Errorf("unexpected output %+v", out)
 	}
+	if _, err = prove(t, &AppCircuit{}, NewAppCircuit(wethUsdc), outputs.DecodeProfitTrackingOutput, sell, tx(0xb8).transferData(t, 0), tx(0xb2).swapData(t, 0)); err == nil {
+		t.Error("expected the circuit to reject a sell worth less than the minimum volume")
+	}
+	wethUsdc.MinVolume = new(big.Int).Div(wholeTokens(12), big.NewInt(10))
+	if _, err = prove(t, &AppCircuit{}, NewAppCircuit(wethUsdc), outputs.DecodeProfitTrackingOutput, sell, tx(0xb7).transferData(t, 0), tx(0xb2).swapData(t, 0)); err == nil {
+		t.Error("expected the circuit to reject a buy below the minimum volume")
+	}
+
+	for name, swap := range map[string]sdk.ReceiptData{
+		// 0xb4 is 11 blocks older than the sell
+		"stale swap":      tx(0xb4).swapData(t, 0),
+		"swap after sell": tx(0xb5).swapData(t, 0),
+		"wrong pool":      tx(0xb6).swapData(t, 0),
+		"not a swap":      tx(0xa2).transferData(t, 0),
+	} {
+		if _, err = prove(t, &AppCircuit{}, NewAppCircuit(params), outputs.DecodeProfitTrackingOutput, buy, sell, swap); err == nil {
+			t.Errorf("%s: expected the circuit to reject the receipts", name)
+		}
+	}
+	if _, err = prove(t, &AppCircuit{}, NewAppCircuit(params), outputs.DecodeProfitTrackingOutput, buy, sell); err == nil {
+		t.Error("expected the circuit to reject a sell without a price")
+	}
+}
+
+// wholeTokens returns n whole tokens in NormalizedDecimals
+func wholeTokens(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), new(big.Int).Exp(big.NewInt(10), big.NewInt(NormalizedDecimals), nil))
 }
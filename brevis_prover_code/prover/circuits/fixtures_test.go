@@ -0,0 +1,149 @@
+package circuits
+
+import (
+	"math/big"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"prover/internal/mockrpc"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/brevis-network/brevis-sdk/test"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// scenarioFile is the mock chain of the tests, in the scenario format of the
+// mockrpc server
+var scenarioFile = filepath.Join("testdata", "scenario.yaml")
+
+// recordedReceipt is a receipt of the scenario with the block it is in
+type recordedReceipt struct {
+	mockrpc.Receipt
+	BlockNumber uint64
+	BaseFee     *big.Int
+}
+
+// loadReceipts reads the receipts of the scenario by tx hash
+func loadReceipts(t *testing.T) map[common.Hash]recordedReceipt {
+	s, err := mockrpc.LoadScenario(scenarioFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipts := make(map[common.Hash]recordedReceipt)
+	for _, b := range s.Blocks {
+		for _, r := range b.Receipts {
+			receipts[r.TxHash] = recordedReceipt{Receipt: r, BlockNumber: b.Number, BaseFee: b.BaseFee}
+		}
+	}
+	return receipts
+}
+
+// logField selects a value of a recorded log, like sdk.LogFieldData
+type logField struct {
+	LogPos     uint
+	IsTopic    bool
+	FieldIndex uint
+}
+
+// receiptData returns the receipt data of the selected log fields. It carries
+// everything the SDK would otherwise query the RPC for, so the tests can check
+// the values the circuits output against it.
+func (r recordedReceipt) receiptData(t *testing.T, fields ...logField) sdk.ReceiptData {
+	data := sdk.ReceiptData{
+		TxHash:       r.TxHash,
+		BlockNum:     new(big.Int).SetUint64(r.BlockNumber),
+		BlockBaseFee: r.BaseFee,
+		// The receipt MPT key is the RLP encoding of the tx index
+		MptKeyPath: new(big.Int).SetBytes(rlp.AppendUint64(nil, uint64(r.TxIndex))),
+	}
+	for _, f := range fields {
+		if int(f.LogPos) >= len(r.Logs) {
+			t.Fatalf("receipt %s has no log %d", r.TxHash.Hex(), f.LogPos)
+		}
+		log := r.Logs[f.LogPos]
+		var value common.Hash
+		if f.IsTopic {
+			value = log.Topics[f.FieldIndex]
+		} else {
+			value = common.BytesToHash(log.Data[f.FieldIndex*32 : f.FieldIndex*32+32])
+		}
+		data.Fields = append(data.Fields, sdk.LogFieldData{
+			Contract:   log.Address,
+			EventID:    log.Topics[0],
+			LogPos:     f.LogPos,
+			IsTopic:    f.IsTopic,
+			FieldIndex: f.FieldIndex,
+			Value:      value,
+		})
+	}
+	return data
+}
+
+// transferData returns the receipt data of the sender and value of the
+// Transfer at logPos
+func (r recordedReceipt) transferData(t *testing.T, logPos uint) sdk.ReceiptData {
+	return r.receiptData(t,
+		logField{LogPos: logPos, IsTopic: true, FieldIndex: 1},
+		logField{LogPos: logPos, IsTopic: false, FieldIndex: 0},
+	)
+}
+
+// swapData returns the receipt data of the pool id and sqrtPriceX96 of the
+// Swap at logPos
+func (r recordedReceipt) swapData(t *testing.T, logPos uint) sdk.ReceiptData {
+	return r.receiptData(t,
+		logField{LogPos: logPos, IsTopic: true, FieldIndex: swapPoolIdTopic},
+		logField{LogPos: logPos, IsTopic: false, FieldIndex: swapSqrtPriceIndex},
+	)
+}
+
+// scenarioApp returns a BrevisApp for the chain of the scenario, served by a
+// mockrpc server
+func scenarioApp(t *testing.T) *sdk.BrevisApp {
+	s, err := mockrpc.LoadScenario(scenarioFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := mockrpc.New(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rpc := httptest.NewServer(server)
+	t.Cleanup(func() {
+		rpc.Close()
+		server.Close()
+	})
+
+	app, err := sdk.NewBrevisApp(s.ChainId, rpc.URL, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+// prove builds the input of the circuit for the receipts, added at index 0, 1
+// and so on, and checks the assignment solves the circuit. A zero ReceiptData
+// leaves its index empty. It returns the output decoded with decode, or the
+// error of a circuit rejecting the receipts.
+func prove[O any](t *testing.T, circuit, assignment sdk.AppCircuit, decode func([]byte) (*O, error), receipts ...sdk.ReceiptData) (*O, error) {
+	t.Helper()
+	app := scenarioApp(t)
+	for i, r := range receipts {
+		if r.TxHash != (common.Hash{}) {
+			app.AddReceipt(r, i)
+		}
+	}
+	in, err := app.BuildCircuitInput(assignment)
+	if err != nil {
+		return nil, err
+	}
+	test.IsSolved(t, circuit, assignment, in)
+
+	out, err := decode(in.GetAbiPackedOutput())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out, nil
+}
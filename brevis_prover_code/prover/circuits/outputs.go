@@ -0,0 +1,132 @@
+package circuits
+
+import (
+	"fmt"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+)
+
+// OutputField is one value of a circuit's packed output
+type OutputField struct {
+	Name string `json:"name"`
+	// Solidity type of the value, e.g. uint64 or address
+	Type string `json:"type"`
+	// Number of bytes the value takes in the packed output
+	Size int `json:"size"`
+}
+
+// OutputSchema is the layout of a circuit's packed output, in output order
+type OutputSchema struct {
+	// Name of the circuit, used to name generated code
+	Name   string        `json:"name"`
+	Fields []OutputField `json:"fields"`
+}
+
+// Size returns the length of the packed output in bytes
+func (s OutputSchema) Size() int {
+	size := 0
+	for _, f := range s.Fields {
+		size += f.Size
+	}
+	return size
+}
+
+// OutputCircuit is a circuit declaring the layout of its output
+type OutputCircuit interface {
+	sdk.AppCircuit
+	OutputSchema() OutputSchema
+}
+
+// OutputCircuits returns every circuit the prover serves
+func OutputCircuits() []OutputCircuit {
+	return []OutputCircuit{
+		&AppCircuit{},
+		&AggregateCircuit{},
+		&TradingVolumeCircuit{},
+		&VolatilityCircuit{},
+	}
+}
+
+// Schema field constructors, matching the outputWriter methods
+func uintField(name string, bits int) OutputField {
+	return OutputField{Name: name, Type: fmt.Sprintf("uint%d", bits), Size: bits / 8}
+}
+
+func addressField(name string) OutputField {
+	return OutputField{Name: name, Type: "address", Size: 20}
+}
+
+func boolField(name string) OutputField {
+	return OutputField{Name: name, Type: "bool", Size: 1}
+}
+
+func bytes32Field(name string) OutputField {
+	return OutputField{Name: name, Type: "bytes32", Size: 32}
+}
+
+// wordField is a value output as a full 32 byte word, as in ABI encoding
+func wordField(name, typ string) OutputField {
+	return OutputField{Name: name, Type: typ, Size: 32}
+}
+
+// outputWriter writes circuit outputs, checking each one against the circuit's
+// output schema so the schema cannot drift from Define
+type outputWriter struct {
+	api    *sdk.CircuitAPI
+	schema OutputSchema
+	next   int
+	err    error
+}
+
+func newOutputWriter(api *sdk.CircuitAPI, schema OutputSchema) *outputWriter {
+	return &outputWriter{api: api, schema: schema}
+}
+
+func (w *outputWriter) check(f OutputField) {
+	if w.err != nil {
+		return
+	}
+	if w.next >= len(w.schema.Fields) {
+		w.err = fmt.Errorf("%s outputs %s but its schema has only %d fields", w.schema.Name, f.Name, len(w.schema.Fields))
+		return
+	}
+	if want := w.schema.Fields[w.next]; want != f {
+		w.err = fmt.Errorf("%s output %d is %+v but its schema declares %+v", w.schema.Name, w.next, f, want)
+		return
+	}
+	w.next++
+}
+
+func (w *outputWriter) Uint(name string, bits int, v sdk.Uint248) {
+	w.check(uintField(name, bits))
+	w.api.OutputUint(bits, v)
+}
+
+func (w *outputWriter) Address(name string, v sdk.Uint248) {
+	w.check(addressField(name))
+	w.api.OutputAddress(v)
+}
+
+func (w *outputWriter) Bool(name string, v sdk.Uint248) {
+	w.check(boolField(name))
+	w.api.OutputBool(v)
+}
+
+func (w *outputWriter) Bytes32(name string, v sdk.Bytes32) {
+	w.check(bytes32Field(name))
+	w.api.OutputBytes32(v)
+}
+
+// Word outputs v as a 32 byte word decoded as typ
+func (w *outputWriter) Word(name, typ string, v sdk.Uint248) {
+	w.check(wordField(name, typ))
+	w.api.OutputBytes32(w.api.ToBytes32(v))
+}
+
+// Done returns an error if the outputs written do not match the schema
+func (w *outputWriter) Done() error {
+	if w.err == nil && w.next != len(w.schema.Fields) {
+		w.err = fmt.Errorf("%s wrote %d outputs but its schema has %d fields", w.schema.Name, w.next, len(w.schema.Fields))
+	}
+	return w.err
+}
@@ -0,0 +1,17 @@
+package circuits
+
+import (
+	"testing"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+)
+
+// TestOutputSchemas compiles every circuit, which fails if what Define outputs
+// does not match the circuit's output schema
+func TestOutputSchemas(t *testing.T) {
+	for _, c := range OutputCircuits() {
+		if _, err := sdk.CompileOnly(c); err != nil {
+			t.Errorf("%s: %s", c.OutputSchema().Name, err.Error())
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package circuits
+
+import (
+	"math/big"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// NormalizedDecimals is the number of decimals PnL and volume are output with
+const NormalizedDecimals = 18
+
+// SwapEventID is the event ID of the Uniswap v4 PoolManager event
+// Swap(bytes32,address,int128,int128,uint160,uint128,int24,uint24)
+var SwapEventID = sdk.ParseEventID(
+	hexutil.MustDecode("0x40e9cecb9f5f1f1c5b9c97dec2917b7ee92e57ba5563708daca94dd84ad7112f"))
+
+// Field indexes of the Swap event read from the price receipt
+const (
+	// topic 1: the pool id
+	swapPoolIdTopic = 1
+	// data 2: the pool's sqrtPriceX96 after the swap
+	swapSqrtPriceIndex = 2
+)
+
+// q96 is the fixed point scale of sqrtPriceX96
+var q96 = new(big.Int).Lsh(big.NewInt(1), 96)
+
+// decimalsScale returns 10^(NormalizedDecimals - decimals), the factor scaling
+// an amount of a token with the given decimals to NormalizedDecimals
+func decimalsScale(api *sdk.CircuitAPI, decimals sdk.Uint248) sdk.Uint248 {
+	u := api.Uint248
+	u.AssertIsLessOrEqual(decimals, sdk.ConstUint248(NormalizedDecimals))
+	scale := sdk.ConstUint248(0)
+	for d := 0; d <= NormalizedDecimals; d++ {
+		factor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(NormalizedDecimals-d)), nil)
+		scale = u.Select(u.IsEqual(decimals, sdk.ConstUint248(d)), sdk.ConstUint248(factor), scale)
+	}
+	return scale
+}
+
+// normalize scales amount by scale. The product is computed in Uint521 so an
+// amount too large to normalize fails the proof instead of wrapping around.
+func normalize(api *sdk.CircuitAPI, amount, scale sdk.Uint248) sdk.Uint248 {
+	return api.ToUint248(api.Uint521.Mul(api.ToUint521(amount), api.ToUint521(scale)))
+}
+
+// convertAtSqrtPrice converts a raw amount of one pool currency into the other
+// at the pool price sqrtPriceX96. The pool price is currency1 per currency0, so
+// amounts of currency0 are multiplied by it and amounts of currency1 divided.
+// The conversion is split into two steps of one sqrtPrice factor each to keep
+// intermediate values within Uint521, at a rounding cost of at most one unit of
+// the result.
+func convertAtSqrtPrice(api *sdk.CircuitAPI, amount, sqrtPriceX96, isCurrency0 sdk.Uint248) sdk.Uint248 {
+	u := api.Uint521
+	a := api.ToUint521(amount)
+	p := api.ToUint521(sqrtPriceX96)
+	q := sdk.ConstUint521(q96)
+
+	// amount * sqrtPrice^2 / 2^192
+	mul, _ := u.Div(u.Mul(a, p), q)
+	mul, _ = u.Div(u.Mul(mul, p), q)
+	// amount * 2^192 / sqrtPrice^2
+	div, _ := u.Div(u.Mul(a, q), p)
+	div, _ = u.Div(u.Mul(div, q), p)
+
+	return api.ToUint248(u.Select(isCurrency0, mul, div))
+}
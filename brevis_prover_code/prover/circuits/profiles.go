@@ -0,0 +1,110 @@
+package circuits
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Circuits a profile can be compiled to
+const (
+	// KindPair proves the PnL of one buy and one sell with AppCircuit
+	KindPair = "pair"
+	// KindAggregate proves the combined PnL of many trades with AggregateCircuit
+	KindAggregate = "aggregate"
+	// KindTradingVolume proves the transfer volume of token 1 over a block
+	// window with TradingVolumeCircuit
+	KindTradingVolume = "trading_volume"
+	// KindVolatility proves the realized volatility of the pool given by
+	// PoolManager and PoolId with VolatilityCircuit
+	KindVolatility = "volatility"
+)
+
+// Profile is a named, versioned set of circuit parameters for one source
+// chain. A profile version never changes once created; changing parameters
+// creates a new version with its own circuit and verifying key.
+type Profile struct {
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+	// Kind selects the circuit, KindPair if empty
+	Kind    string `json:"kind,omitempty"`
+	ChainId uint64 `json:"chain_id"`
+	Params  Params `json:"params"`
+}
+
+var profileName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// MaxUint248 is the largest value of a circuit's Uint248 custom inputs
+var MaxUint248 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 248), big.NewInt(1))
+
+// ID identifies the profile version, e.g. usdc-usdt-v1
+func (p Profile) ID() string {
+	return fmt.Sprintf("%s-v%d", p.Name, p.Version)
+}
+
+// Validate checks that the profile can be compiled and stored
+func (p Profile) Validate() error {
+	if !profileName.MatchString(p.Name) {
+		return fmt.Errorf("invalid profile name %q: use lowercase letters, digits, '-' and '_'", p.Name)
+	}
+	if p.Version < 1 {
+		return fmt.Errorf("invalid profile version %d", p.Version)
+	}
+	if p.ChainId == 0 {
+		return fmt.Errorf("profile %s has no chain id", p.ID())
+	}
+	if p.Params.MinVolume == nil {
+		return fmt.Errorf("profile %s has no minimum volume", p.ID())
+	}
+	if p.Params.MinVolume.Sign() < 0 || p.Params.MinVolume.Cmp(MaxUint248) > 0 {
+		return fmt.Errorf("profile %s has a minimum volume outside [0, 2^248)", p.ID())
+	}
+	if p.Params.Token1Addr == (common.Address{}) {
+		return fmt.Errorf("profile %s has no token 1", p.ID())
+	}
+	// trading volume circuits only track token 1
+	if p.Kind != KindTradingVolume && p.Params.Token1Addr == p.Params.Token2Addr {
+		return fmt.Errorf("profile %s trades token %s against itself", p.ID(), p.Params.Token1Addr.Hex())
+	}
+	if p.Params.Token1Decimals > NormalizedDecimals || p.Params.Token2Decimals > NormalizedDecimals {
+		return fmt.Errorf("profile %s has token decimals above %d", p.ID(), NormalizedDecimals)
+	}
+	if (p.Kind == KindAggregate || p.Kind == KindTradingVolume) && p.Params.UsesPrice() {
+		return fmt.Errorf("profile %s: %s circuits do not support pool prices", p.ID(), p.Kind)
+	}
+	if p.Kind == KindVolatility && !p.Params.UsesPrice() {
+		return fmt.Errorf("profile %s: volatility circuits need a pool manager", p.ID())
+	}
+	_, err := p.Circuit()
+	return err
+}
+
+// Circuit returns the profile's circuit with its custom inputs assigned the
+// profile's parameters
+func (p Profile) Circuit() (sdk.AppCircuit, error) {
+	switch p.Kind {
+	case "", KindPair:
+		return NewAppCircuit(p.Params), nil
+	case KindAggregate:
+		return NewAggregateCircuit(p.Params), nil
+	case KindTradingVolume:
+		return NewTradingVolumeCircuit(p.Params), nil
+	case KindVolatility:
+		return NewVolatilityCircuit(p.Params), nil
+	}
+	return nil, fmt.Errorf("profile %s has unknown kind %q", p.ID(), p.Kind)
+}
+
+// DefaultProfile returns the profile the prover starts with
+func DefaultProfile() Profile {
+	return Profile{
+		Name:    "usdc-usdt",
+		Version: 1,
+		Kind:    KindPair,
+		ChainId: 1,
+		Params:  DefaultParams(),
+	}
+}
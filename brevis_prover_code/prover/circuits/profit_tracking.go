@@ -1,22 +1,130 @@
 package circuits
 
 import (
+	"math/big"
+
+	"prover/tokens"
+
 	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 )
 
-// Circuit is a global variable so we can update its parameters
-var (
-	Circuit    = &AppCircuit{}
-	Token1Addr = sdk.ConstUint248("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48") // Default: USDC
-	Token2Addr = sdk.ConstUint248("0xdAC17F958D2ee523a2206206994597C13D831ec7") // Default: USDT
-	MinVolume  = sdk.ConstUint248(500000000)                                    // Default: 500 tokens
-)
+// TransferEventID is the event ID of the ERC-20 Transfer(address,address,uint256) event
+var TransferEventID = sdk.ParseEventID(
+	hexutil.MustDecode("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"))
+
+// Params are the default custom inputs of AppCircuit. They are not compiled
+// into the circuit, so all parameter sets share one verifying key; the values
+// a proof was generated with are committed to in its output instead.
+type Params struct {
+	Token1Addr common.Address `json:"token1_address"`
+	Token2Addr common.Address `json:"token2_address"`
+	// MinVolume is the minimum value of a leg in token 1 units. Legs of token 2
+	// are valued in token 1 the way the PnL is.
+	MinVolume      *big.Int `json:"minimum_volume"`
+	Token1Decimals uint8    `json:"token1_decimals"`
+	Token2Decimals uint8    `json:"token2_decimals"`
+	// PoolManager and PoolId select the Uniswap v4 pool whose Swap event
+	// prices token 2 in token 1. Without a pool manager, amounts of the two
+	// tokens are only normalized to NormalizedDecimals and compared 1:1.
+	PoolManager common.Address `json:"pool_manager,omitempty"`
+	PoolId      common.Hash    `json:"pool_id,omitempty"`
+}
+
+// UsesPrice returns whether the parameters price token 2 with a pool
+func (p Params) UsesPrice() bool {
+	return p.PoolManager != (common.Address{})
+}
+
+// DefaultParams returns the parameters the prover starts with: USDC/USDT on
+// Ethereum with a minimum volume of 500 USDC
+func DefaultParams() Params {
+	return PairParams(tokens.Builtin().MustPair(1, "USDC/USDT"), big.NewInt(500_000_000))
+}
+
+// PairParams returns the parameters of a pair of tokens. The pair's pool, if
+// known, prices token 2 in token 1.
+func PairParams(pair tokens.Pair, minVolume *big.Int) Params {
+	p := Params{
+		Token1Addr: pair.Token1.Address,
+		Token2Addr: pair.Token2.Address,
+		MinVolume:  minVolume,
+
+		Token1Decimals: pair.Token1.Decimals,
+		Token2Decimals: pair.Token2.Decimals,
+	}
+	if pair.Pool != nil {
+		p.PoolManager = pair.Pool.Manager
+		p.PoolId = pair.Pool.ID()
+	}
+	return p
+}
 
-// AppCircuit is our circuit implementation
-type AppCircuit struct{}
+// NewAppCircuit returns a circuit assignment with its custom inputs set to p
+func NewAppCircuit(p Params) *AppCircuit {
+	return &AppCircuit{
+		Token1Addr: sdk.ConstUint248(p.Token1Addr),
+		Token2Addr: sdk.ConstUint248(p.Token2Addr),
+		MinVolume:  sdk.ConstUint248(p.MinVolume),
+
+		Token1Decimals: sdk.ConstUint248(p.Token1Decimals),
+		Token2Decimals: sdk.ConstUint248(p.Token2Decimals),
+		PoolManager:    sdk.ConstUint248(p.PoolManager),
+		PoolId:         sdk.ConstFromBigEndianBytes(p.PoolId[:]),
+	}
+}
+
+// MaxSwapAge is the number of blocks the Swap pricing a sell may precede it by.
+// The prover picks the Swap, so without a bound it could pick a stale price
+// that turns a loss into a profit.
+const MaxSwapAge = 10
+
+// AppCircuit is our circuit implementation. Receipt 0 is the buy and receipt
+// 1 the sell. If PoolManager is set, receipt 2 is a Swap of the pool pricing
+// token 2 in token 1, emitted before the sell and at most MaxSwapAge blocks
+// earlier.
+type AppCircuit struct {
+	// Token bought in the first receipt
+	Token1Addr sdk.Uint248
+	// Token sold in the second receipt
+	Token2Addr sdk.Uint248
+	// Minimum value of both legs in token 1 units
+	MinVolume sdk.Uint248
+	// Decimals of token 1 and token 2
+	Token1Decimals sdk.Uint248
+	Token2Decimals sdk.Uint248
+	// Uniswap v4 PoolManager emitting the price Swap, zero for no price
+	PoolManager sdk.Uint248
+	// Id of the pool pricing token 2 in token 1
+	PoolId sdk.Bytes32
+}
 
 var _ sdk.AppCircuit = &AppCircuit{}
 
+// OutputSchema returns the layout of the circuit's output
+func (c *AppCircuit) OutputSchema() OutputSchema {
+	return OutputSchema{
+		Name: "ProfitTracking",
+		Fields: []OutputField{
+			uintField("buyBlockNum", 64),
+			uintField("sellBlockNum", 64),
+			addressField("account"),
+			uintField("pnlAmount", 248),
+			boolField("isProfit"),
+			addressField("token1"),
+			addressField("token2"),
+			uintField("minVolume", 248),
+			uintField("token1Decimals", 8),
+			uintField("token2Decimals", 8),
+			addressField("poolManager"),
+			bytes32Field("poolId"),
+			uintField("sqrtPriceX96", 160),
+			uintField("swapBlockNum", 64),
+		},
+	}
+}
+
 func (c *AppCircuit) Allocate() (maxReceipts, maxStorage, maxTransactions int) {
 	return 32, 0, 0
 }
@@ -30,22 +138,31 @@ func (c *AppCircuit) Define(api *sdk.CircuitAPI, in sdk.DataInput) error {
 	sellReceipt := sdk.GetUnderlying(receipts, 1)
 
 	// Verify token 1 transaction (buy)
-	api.Uint248.AssertIsEqual(buyReceipt.Fields[0].Contract, Token1Addr)
+	api.Uint248.AssertIsEqual(buyReceipt.Fields[0].Contract, c.Token1Addr)
+	api.Uint248.AssertIsEqual(buyReceipt.Fields[0].EventID, TransferEventID)
+	api.Uint248.AssertIsEqual(buyReceipt.Fields[1].EventID, TransferEventID)
 	api.Uint248.AssertIsEqual(buyReceipt.Fields[0].IsTopic, sdk.ConstUint248(1))
 	api.Uint248.AssertIsEqual(buyReceipt.Fields[0].Index, sdk.ConstUint248(1))
 	api.Uint32.AssertIsEqual(buyReceipt.Fields[0].LogPos, buyReceipt.Fields[1].LogPos)
 	api.Uint248.AssertIsEqual(buyReceipt.Fields[1].IsTopic, sdk.ConstUint248(0))
 	api.Uint248.AssertIsEqual(buyReceipt.Fields[1].Index, sdk.ConstUint248(0))
-	api.Uint248.AssertIsLessOrEqual(MinVolume, api.ToUint248(buyReceipt.Fields[1].Value))
 
 	// Verify token 2 transaction (sell)
-	api.Uint248.AssertIsEqual(sellReceipt.Fields[0].Contract, Token2Addr)
+	api.Uint248.AssertIsEqual(sellReceipt.Fields[0].Contract, c.Token2Addr)
+	api.Uint248.AssertIsEqual(sellReceipt.Fields[0].EventID, TransferEventID)
+	api.Uint248.AssertIsEqual(sellReceipt.Fields[1].EventID, TransferEventID)
 	api.Uint248.AssertIsEqual(sellReceipt.Fields[0].IsTopic, sdk.ConstUint248(1))
 	api.Uint248.AssertIsEqual(sellReceipt.Fields[0].Index, sdk.ConstUint248(1))
 	api.Uint32.AssertIsEqual(sellReceipt.Fields[0].LogPos, sellReceipt.Fields[1].LogPos)
 	api.Uint248.AssertIsEqual(sellReceipt.Fields[1].IsTopic, sdk.ConstUint248(0))
 	api.Uint248.AssertIsEqual(sellReceipt.Fields[1].Index, sdk.ConstUint248(0))
-	api.Uint248.AssertIsLessOrEqual(MinVolume, api.ToUint248(sellReceipt.Fields[1].Value))
+
+	// Verify the buy happened strictly before the sell. This also rejects a
+	// sell that references the same log as the buy.
+	api.Uint248.AssertIsLessOrEqual(
+		api.Uint248.Add(logOrder(api, buyReceipt), sdk.ConstUint248(1)),
+		logOrder(api, sellReceipt),
+	)
 
 	// Verify the same account is involved in both transactions
 	api.Uint248.AssertIsEqual(api.ToUint248(buyReceipt.Fields[0].Value), api.ToUint248(sellReceipt.Fields[0].Value))
@@ -54,24 +171,117 @@ func (c *AppCircuit) Define(api *sdk.CircuitAPI, in sdk.DataInput) error {
 	buyValue := api.ToUint248(buyReceipt.Fields[1].Value)
 	sellValue := api.ToUint248(sellReceipt.Fields[1].Value)
 
-	// Compare values to determine if there's a profit
-	// Check if buyValue <= sellValue (direct assertion as requested)
-	api.Uint248.AssertIsLessOrEqual(buyValue, sellValue)
+	// Price the sell in token 1 if a pool is given, then scale both legs to
+	// NormalizedDecimals so tokens with different decimals compare correctly
+	usePrice := api.Uint248.Not(api.Uint248.IsZero(c.PoolManager))
+	sqrtPriceX96, swapBlockNum := c.swapSqrtPrice(api, in, usePrice, sellReceipt)
+	token2IsCurrency0 := api.Uint248.IsLessThan(c.Token2Addr, c.Token1Addr)
+	sellInToken1 := convertAtSqrtPrice(api, sellValue, sqrtPriceX96, token2IsCurrency0)
 
-	// Since we've asserted buyValue <= sellValue, we know there's a profit
-	// Calculate profit amount (sellValue - buyValue)
-	profitAmount := api.Uint248.Sub(sellValue, buyValue)
+	scale1 := decimalsScale(api, c.Token1Decimals)
+	scale2 := decimalsScale(api, c.Token2Decimals)
+	buyValue = normalize(api, buyValue, scale1)
+	sellValue = api.Uint248.Select(usePrice,
+		normalize(api, sellInToken1, scale1),
+		normalize(api, sellValue, scale2),
+	)
+
+	// Verify both legs are worth the minimum volume, which is in token 1 units
+	minVolume := normalize(api, c.MinVolume, scale1)
+	api.Uint248.AssertIsLessOrEqual(minVolume, buyValue)
+	api.Uint248.AssertIsLessOrEqual(minVolume, sellValue)
+
+	// Uint248 cannot hold negative values, so the PnL is kept as a sign bit
+	// and a magnitude. Breaking even counts as a profit of zero.
+	isLoss := api.Uint248.IsLessThan(sellValue, buyValue)
+	isProfit := api.Uint248.Not(isLoss)
+	pnlAmount := api.Uint248.Select(isLoss,
+		api.Uint248.Sub(buyValue, sellValue),
+		api.Uint248.Sub(sellValue, buyValue),
+	)
 
 	// Output results
-	api.OutputUint(64, api.ToUint248(buyReceipt.BlockNum))
-	api.OutputUint(64, api.ToUint248(sellReceipt.BlockNum))
-	api.OutputAddress(api.ToUint248(buyReceipt.Fields[0].Value))
+	out := newOutputWriter(api, c.OutputSchema())
+	out.Uint("buyBlockNum", 64, api.ToUint248(buyReceipt.BlockNum))
+	out.Uint("sellBlockNum", 64, api.ToUint248(sellReceipt.BlockNum))
+	out.Address("account", api.ToUint248(buyReceipt.Fields[0].Value))
 
-	// Convert profitAmount (Uint248) to the appropriate type for OutputUint
-	api.OutputUint(248, profitAmount)
+	// Output the PnL magnitude in NormalizedDecimals followed by whether it is
+	// a profit or a loss
+	out.Uint("pnlAmount", 248, pnlAmount)
+	out.Bool("isProfit", isProfit)
 
-	// Output true since we've asserted there's a profit
-	api.OutputBool(sdk.Uint248(sdk.ConstUint32(1)))
+	// Commit to the custom inputs so verifiers can check which pair and
+	// threshold the proof was generated for
+	out.Address("token1", c.Token1Addr)
+	out.Address("token2", c.Token2Addr)
+	out.Uint("minVolume", 248, c.MinVolume)
+	out.Uint("token1Decimals", 8, c.Token1Decimals)
+	out.Uint("token2Decimals", 8, c.Token2Decimals)
+	out.Address("poolManager", c.PoolManager)
+	out.Bytes32("poolId", c.PoolId)
+	// The price the sell was converted at and the block of its Swap, zero if
+	// the sell was not priced
+	out.Uint("sqrtPriceX96", 160, api.Uint248.Select(usePrice, sqrtPriceX96, sdk.ConstUint248(0)))
+	out.Uint("swapBlockNum", 64, api.Uint248.Select(usePrice, swapBlockNum, sdk.ConstUint248(0)))
+
+	return out.Done()
+}
+
+// swapSqrtPrice returns the pool price and block of the Swap in receipt 2 if
+// usePrice is set, and a price of 1 otherwise. The Swap must be emitted by
+// PoolManager for PoolId before the sell, and at most MaxSwapAge blocks
+// earlier.
+func (c *AppCircuit) swapSqrtPrice(api *sdk.CircuitAPI, in sdk.DataInput, usePrice sdk.Uint248, sell sdk.Receipt) (sqrtPriceX96, blockNum sdk.Uint248) {
+	u := api.Uint248
+	swap := in.Receipts.Raw[2]
+	toggle := sdk.Uint248{Val: in.Receipts.Toggles[2]}
+	blockNum = api.ToUint248(swap.BlockNum)
+
+	valid := u.And(
+		toggle,
+		u.IsEqual(swap.Fields[0].Contract, c.PoolManager),
+		u.IsEqual(swap.Fields[1].Contract, c.PoolManager),
+		u.IsEqual(swap.Fields[0].EventID, SwapEventID),
+		u.IsEqual(swap.Fields[1].EventID, SwapEventID),
+		u.IsEqual(swap.Fields[0].IsTopic, sdk.ConstUint248(1)),
+		u.IsEqual(swap.Fields[0].Index, sdk.ConstUint248(swapPoolIdTopic)),
+		api.Bytes32.IsEqual(swap.Fields[0].Value, c.PoolId),
+		u.IsEqual(swap.Fields[1].IsTopic, sdk.ConstUint248(0)),
+		u.IsEqual(swap.Fields[1].Index, sdk.ConstUint248(swapSqrtPriceIndex)),
+		u.IsEqual(api.ToUint248(swap.Fields[0].LogPos), api.ToUint248(swap.Fields[1].LogPos)),
+		u.IsLessThan(logOrder(api, swap), logOrder(api, sell)),
+		u.Not(u.IsGreaterThan(api.ToUint248(sell.BlockNum), u.Add(blockNum, sdk.ConstUint248(MaxSwapAge)))),
+	)
+	u.AssertIsEqual(u.Select(usePrice, valid, sdk.ConstUint248(1)), sdk.ConstUint248(1))
+
+	return u.Select(usePrice, api.ToUint248(swap.Fields[1].Value), sdk.ConstUint248(q96)), blockNum
+}
+
+// logOrder returns a value ordering the receipt's first log by block number,
+// transaction index and log position
+func logOrder(api *sdk.CircuitAPI, r sdk.Receipt) sdk.Uint248 {
+	blockNum := api.ToUint248(r.BlockNum)
+	txIndex := txIndexFromMptKey(api, api.ToUint248(r.MptKeyPath))
+	logPos := api.ToUint248(r.Fields[0].LogPos)
+
+	// Each component fits in 32 bits
+	order := api.Uint248.Mul(blockNum, sdk.ConstUint248(new(big.Int).Lsh(big.NewInt(1), 64)))
+	order = api.Uint248.Add(order, api.Uint248.Mul(txIndex, sdk.ConstUint248(new(big.Int).Lsh(big.NewInt(1), 32))))
+	return api.Uint248.Add(order, logPos)
+}
 
-	return nil
+// txIndexFromMptKey decodes the transaction index from the receipt's MPT key,
+// which is the RLP encoding of the index. Unlike the key, the index orders
+// transactions within a block.
+func txIndexFromMptKey(api *sdk.CircuitAPI, key sdk.Uint248) sdk.Uint248 {
+	u := api.Uint248
+	// 0x80 encodes 0, smaller keys are single byte indexes and larger keys are
+	// a length prefix of 0x80 + n followed by n bytes of the index
+	index := u.Select(u.IsEqual(key, sdk.ConstUint248(0x80)), sdk.ConstUint248(0), key)
+	for n := 1; n <= 3; n++ {
+		prefix := new(big.Int).Lsh(big.NewInt(int64(0x80+n)), uint(8*n))
+		index = u.Select(u.IsLessThan(key, sdk.ConstUint248(prefix)), index, u.Sub(key, sdk.ConstUint248(prefix)))
+	}
+	return index
 }
@@ -0,0 +1,124 @@
+package circuits
+
+import (
+	"math"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+)
+
+// NewTradingVolumeCircuit returns a circuit assignment counting transfers of
+// p.Token1Addr. The block window defaults to all blocks and is narrowed by each
+// proof request's custom input.
+func NewTradingVolumeCircuit(p Params) *TradingVolumeCircuit {
+	return &TradingVolumeCircuit{
+		Token:      sdk.ConstUint248(p.Token1Addr),
+		StartBlock: sdk.ConstUint248(0),
+		EndBlock:   sdk.ConstUint248(uint64(math.MaxUint64)),
+	}
+}
+
+// TradingVolumeCircuit proves the volume an account transferred of one token
+// over a block window, for BrevisVerificationHook. Every receipt is a Transfer
+// of Token out of the account, ordered by block, transaction and log position.
+//
+// The output is {accountAddr, blockNum, volume, timestamp, historicalVolume},
+// one 32 byte word per field, followed by the token and block window the proof
+// is for. The hook decodes it with the generated TradingVolumeOutput library.
+// Receipts carry no block timestamp, so timestamp is always zero and the hook
+// has to go by blockNum instead.
+type TradingVolumeCircuit struct {
+	// Token whose transfers are counted
+	Token sdk.Uint248
+	// Inclusive block window the transfers must be in
+	StartBlock sdk.Uint248
+	EndBlock   sdk.Uint248
+}
+
+var _ sdk.AppCircuit = &TradingVolumeCircuit{}
+
+// OutputSchema returns the layout of the circuit's output
+func (c *TradingVolumeCircuit) OutputSchema() OutputSchema {
+	return OutputSchema{
+		Name: "TradingVolume",
+		Fields: []OutputField{
+			wordField("accountAddr", "address"),
+			wordField("blockNum", "uint64"),
+			wordField("volume", "uint256"),
+			wordField("timestamp", "uint256"),
+			wordField("historicalVolume", "uint256"),
+			addressField("token"),
+			uintField("startBlock", 64),
+			uintField("endBlock", 64),
+		},
+	}
+}
+
+func (c *TradingVolumeCircuit) Allocate() (maxReceipts, maxStorage, maxTransactions int) {
+	return 32, 0, 0
+}
+
+func (c *TradingVolumeCircuit) Define(api *sdk.CircuitAPI, in sdk.DataInput) error {
+	u := api.Uint248
+	receipts := sdk.NewDataStream(api, in.Receipts)
+
+	u.AssertIsLessOrEqual(c.StartBlock, c.EndBlock)
+
+	// All transfers belong to the account of the first one. Receipt 0 must be
+	// on, so the account is taken from a verified transfer and the stream is
+	// not empty.
+	u.AssertIsEqual(sdk.Uint248{Val: in.Receipts.Toggles[0]}, sdk.ConstUint248(1))
+	account := api.ToUint248(sdk.GetUnderlying(receipts, 0).Fields[0].Value)
+
+	// Verify every receipt is a Transfer of the token out of the account
+	// within the window
+	sdk.AssertEach(receipts, func(r sdk.Receipt) sdk.Uint248 {
+		blockNum := api.ToUint248(r.BlockNum)
+		return u.And(
+			u.IsEqual(r.Fields[0].Contract, c.Token),
+			u.IsEqual(r.Fields[1].Contract, c.Token),
+			u.IsEqual(r.Fields[0].EventID, TransferEventID),
+			u.IsEqual(r.Fields[1].EventID, TransferEventID),
+			u.IsEqual(r.Fields[0].IsTopic, sdk.ConstUint248(1)),
+			u.IsEqual(r.Fields[0].Index, sdk.ConstUint248(1)),
+			u.IsEqual(r.Fields[1].IsTopic, sdk.ConstUint248(0)),
+			u.IsEqual(r.Fields[1].Index, sdk.ConstUint248(0)),
+			u.IsEqual(api.ToUint248(r.Fields[0].LogPos), api.ToUint248(r.Fields[1].LogPos)),
+			u.IsEqual(api.ToUint248(r.Fields[0].Value), account),
+			u.Not(u.IsLessThan(blockNum, c.StartBlock)),
+			u.Not(u.IsGreaterThan(blockNum, c.EndBlock)),
+		)
+	})
+
+	// Strict ordering makes sure no transfer is counted twice
+	sdk.AssertSorted(receipts, func(a, b sdk.Receipt) sdk.Uint248 {
+		return u.IsLessThan(logOrder(api, a), logOrder(api, b))
+	})
+
+	values := sdk.Map(receipts, func(r sdk.Receipt) sdk.Uint248 {
+		return api.ToUint248(r.Fields[1].Value)
+	})
+	historicalVolume := sdk.Sum(values)
+
+	// The receipts are sorted, so the last one is the most recent transfer
+	latest := sdk.Reduce(receipts, sdk.GetUnderlying(receipts, 0), func(_ sdk.Receipt, r sdk.Receipt) sdk.Receipt {
+		return r
+	})
+	blockNum := api.ToUint248(latest.BlockNum)
+	volume := api.ToUint248(latest.Fields[1].Value)
+
+	// Output the public inputs the hook checks
+	out := newOutputWriter(api, c.OutputSchema())
+	out.Word("accountAddr", "address", account)
+	out.Word("blockNum", "uint64", blockNum)
+	out.Word("volume", "uint256", volume)
+	out.Word("timestamp", "uint256", sdk.ConstUint248(0))
+	out.Word("historicalVolume", "uint256", historicalVolume)
+
+	// Commit to the custom inputs so verifiers can check which token and
+	// window the proof was generated for
+	out.Address("token", c.Token)
+	out.Uint("startBlock", 64, c.StartBlock)
+	out.Uint("endBlock", 64, c.EndBlock)
+
+	return out.Done()
+}
@@ -0,0 +1,69 @@
+package circuits
+
+import (
+	"math/big"
+	"testing"
+
+	"prover/outputs"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestTradingVolumeCircuit(t *testing.T) {
+	receipts := loadReceipts(t)
+	transfer := func(n byte) sdk.ReceiptData {
+		return receipts[common.BigToHash(big.NewInt(int64(n)))].transferData(t, 0)
+	}
+	// The account sends 1050 USDT in 0xa7 and 0xa2, then 900 USDT in 0xa3
+	usdt := DefaultParams()
+	usdt.Token1Addr = usdt.Token2Addr
+	transfers := []sdk.ReceiptData{transfer(0xa7), transfer(0xa2), transfer(0xa3)}
+
+	out, err := prove(t, &TradingVolumeCircuit{}, NewTradingVolumeCircuit(usdt), outputs.DecodeTradingVolumeOutput, transfers...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.AccountAddr != common.HexToAddress("0x1111111111111111111111111111111111111111") ||
+		out.HistoricalVolume.Cmp(big.NewInt(3000_000000)) != 0 || out.Volume.Cmp(big.NewInt(900_000000)) != 0 ||
+		out.BlockNum != 19000200 || out.Timestamp.Sign() != 0 || out.StartBlock != 0 || out.EndBlock != ^uint64(0) {
+		t.Errorf("unexpected output %+v", out)
+	}
+
+	// The window is inclusive
+	window := func(start, end uint64) *TradingVolumeCircuit {
+		c := NewTradingVolumeCircuit(usdt)
+		c.StartBlock = sdk.ConstUint248(start)
+		c.EndBlock = sdk.ConstUint248(end)
+		return c
+	}
+	if out, err = prove(t, &TradingVolumeCircuit{}, window(18999900, 19000200), outputs.DecodeTradingVolumeOutput, transfers...); err != nil {
+		t.Fatal(err)
+	}
+	if out.StartBlock != 18999900 || out.EndBlock != 19000200 {
+		t.Errorf("unexpected window %d to %d", out.StartBlock, out.EndBlock)
+	}
+
+	for name, c := range map[string]struct {
+		assignment *TradingVolumeCircuit
+		transfers  []sdk.ReceiptData
+	}{
+		"before the window": {window(18999901, 19000200), transfers},
+		"after the window":  {window(18999900, 19000199), transfers},
+		"empty window":      {window(19000200, 18999900), transfers},
+		"wrong token":       {NewTradingVolumeCircuit(usdt), []sdk.ReceiptData{transfer(0xa2), receipts[common.BigToHash(big.NewInt(0xa1))].transferData(t, 1)}},
+		"wrong account":     {NewTradingVolumeCircuit(usdt), []sdk.ReceiptData{transfer(0xa2), transfer(0xa5)}},
+		"not a transfer":    {NewTradingVolumeCircuit(usdt), []sdk.ReceiptData{transfer(0xa2), transfer(0xa8)}},
+		"counted twice":     {NewTradingVolumeCircuit(usdt), []sdk.ReceiptData{transfer(0xa2), transfer(0xa2)}},
+	} {
+		if _, err = prove(t, &TradingVolumeCircuit{}, c.assignment, outputs.DecodeTradingVolumeOutput, c.transfers...); err == nil {
+			t.Errorf("%s: expected the circuit to reject the receipts", name)
+		}
+	}
+
+	// Without a first transfer the account and latest transfer would not come
+	// from a verified receipt
+	if _, err = prove(t, &TradingVolumeCircuit{}, NewTradingVolumeCircuit(usdt), outputs.DecodeTradingVolumeOutput, sdk.ReceiptData{}, transfer(0xa2)); err == nil {
+		t.Error("no first transfer: expected the circuit to reject the receipts")
+	}
+}
@@ -0,0 +1,164 @@
+package circuits
+
+import (
+	"github.com/brevis-network/brevis-sdk/sdk"
+)
+
+// MinVolatilitySamples is the number of price samples a volatility proof
+// needs at least, and MaxVolatilityWindow the number of blocks they may span at
+// most. The prover still picks which Swaps of the window are sampled, so
+// verifiers that need evenly spread samples have to check the sample count and
+// blocks in the output.
+const (
+	MinVolatilitySamples = 8
+	MaxVolatilityWindow  = 7200
+)
+
+// NewVolatilityCircuit returns a circuit assignment sampling the pool given by
+// p.PoolManager and p.PoolId
+func NewVolatilityCircuit(p Params) *VolatilityCircuit {
+	return &VolatilityCircuit{
+		PoolManager: sdk.ConstUint248(p.PoolManager),
+		PoolId:      sdk.ConstFromBigEndianBytes(p.PoolId[:]),
+	}
+}
+
+// VolatilityCircuit proves the realized volatility of a Uniswap v4 pool for
+// ComprehensiveBotHook. The receipts are MinVolatilitySamples to 32 samples of
+// the pool price within MaxVolatilityWindow blocks, each a Swap of the pool
+// ordered by block, transaction and log position. The volatility is the sample
+// standard deviation of the price returns between consecutive samples, in
+// basis points.
+//
+// The output is {historicalVolatilityBps, relevantTimestamp}, one 32 byte word
+// per field, followed by the pool the proof is for and the blocks and number of
+// the samples. The hooks decode it with the generated VolatilityOutput library.
+// Receipts carry no block timestamp, so relevantTimestamp is always zero and
+// the hooks have to go by lastBlock instead.
+type VolatilityCircuit struct {
+	// Uniswap v4 PoolManager emitting the Swaps
+	PoolManager sdk.Uint248
+	// Id of the sampled pool
+	PoolId sdk.Bytes32
+}
+
+var _ sdk.AppCircuit = &VolatilityCircuit{}
+
+// OutputSchema returns the layout of the circuit's output
+func (c *VolatilityCircuit) OutputSchema() OutputSchema {
+	return OutputSchema{
+		Name: "Volatility",
+		Fields: []OutputField{
+			wordField("historicalVolatilityBps", "uint256"),
+			wordField("relevantTimestamp", "uint256"),
+			addressField("poolManager"),
+			bytes32Field("poolId"),
+			uintField("firstBlock", 64),
+			uintField("lastBlock", 64),
+			uintField("sampleCount", 32),
+		},
+	}
+}
+
+func (c *VolatilityCircuit) Allocate() (maxReceipts, maxStorage, maxTransactions int) {
+	return 32, 0, 0
+}
+
+func (c *VolatilityCircuit) Define(api *sdk.CircuitAPI, in sdk.DataInput) error {
+	u := api.Uint248
+	samples := in.Receipts.Raw
+	toggles := in.Receipts.Toggles
+
+	// Samples must be a prefix of the receipts so consecutive ones are
+	// neighbours, and there must be at least MinVolatilitySamples
+	u.AssertIsEqual(sdk.Uint248{Val: toggles[MinVolatilitySamples-1]}, sdk.ConstUint248(1))
+	for i := 1; i < len(samples); i++ {
+		u.AssertIsLessOrEqual(sdk.Uint248{Val: toggles[i]}, sdk.Uint248{Val: toggles[i-1]})
+	}
+
+	// Returns are summed by sign, and their squares in Uint521, so large
+	// returns fail the proof instead of wrapping around
+	sumUp := sdk.ConstUint521(0)
+	sumDown := sdk.ConstUint521(0)
+	sumSquares := sdk.ConstUint521(0)
+	count := sdk.ConstUint248(0)
+	firstBlock := api.ToUint248(samples[0].BlockNum)
+	lastBlock := firstBlock
+	for i := range samples {
+		on := sdk.Uint248{Val: toggles[i]}
+		s := samples[i]
+
+		valid := u.And(
+			u.IsEqual(s.Fields[0].Contract, c.PoolManager),
+			u.IsEqual(s.Fields[1].Contract, c.PoolManager),
+			u.IsEqual(s.Fields[0].EventID, SwapEventID),
+			u.IsEqual(s.Fields[1].EventID, SwapEventID),
+			u.IsEqual(s.Fields[0].IsTopic, sdk.ConstUint248(1)),
+			u.IsEqual(s.Fields[0].Index, sdk.ConstUint248(swapPoolIdTopic)),
+			api.Bytes32.IsEqual(s.Fields[0].Value, c.PoolId),
+			u.IsEqual(s.Fields[1].IsTopic, sdk.ConstUint248(0)),
+			u.IsEqual(s.Fields[1].Index, sdk.ConstUint248(swapSqrtPriceIndex)),
+			u.IsEqual(api.ToUint248(s.Fields[0].LogPos), api.ToUint248(s.Fields[1].LogPos)),
+		)
+		u.AssertIsEqual(u.Select(on, valid, sdk.ConstUint248(1)), sdk.ConstUint248(1))
+		count = u.Add(count, on)
+		lastBlock = u.Select(on, api.ToUint248(s.BlockNum), lastBlock)
+		if i == 0 {
+			continue
+		}
+
+		prev := samples[i-1]
+		u.AssertIsEqual(u.Select(on, u.IsLessThan(logOrder(api, prev), logOrder(api, s)), sdk.ConstUint248(1)), sdk.ConstUint248(1))
+
+		magnitude, up := c.returnBps(api, prev, s, on)
+		ret := api.Uint521.Select(on, api.ToUint521(magnitude), sdk.ConstUint521(0))
+		sumUp = api.Uint521.Add(sumUp, api.Uint521.Select(up, ret, sdk.ConstUint521(0)))
+		sumDown = api.Uint521.Add(sumDown, api.Uint521.Select(up, sdk.ConstUint521(0), ret))
+		sumSquares = api.Uint521.Add(sumSquares, api.Uint521.Mul(ret, ret))
+	}
+	u.AssertIsLessOrEqual(lastBlock, u.Add(firstBlock, sdk.ConstUint248(MaxVolatilityWindow)))
+
+	// The sample variance of the n returns r is
+	// (n * sum(r²) - sum(r)²) / (n * (n - 1)), which is never negative
+	n := u.Sub(count, sdk.ConstUint248(1))
+	up, down := api.ToUint248(sumUp), api.ToUint248(sumDown)
+	sum := api.ToUint521(u.Select(u.IsLessThan(up, down), u.Sub(down, up), u.Sub(up, down)))
+	spread := api.Uint521.Sub(api.Uint521.Mul(api.ToUint521(n), sumSquares), api.Uint521.Mul(sum, sum))
+	variance, _ := api.Uint521.Div(spread, api.ToUint521(u.Mul(n, u.Sub(n, sdk.ConstUint248(1)))))
+	volatilityBps := u.Sqrt(api.ToUint248(variance))
+
+	// Output the public inputs the hooks check
+	out := newOutputWriter(api, c.OutputSchema())
+	out.Word("historicalVolatilityBps", "uint256", volatilityBps)
+	out.Word("relevantTimestamp", "uint256", sdk.ConstUint248(0))
+
+	// Commit to the custom inputs so verifiers can check which pool the proof
+	// was generated for, and to the samples so they can check how many there
+	// were and when
+	out.Address("poolManager", c.PoolManager)
+	out.Bytes32("poolId", c.PoolId)
+	out.Uint("firstBlock", 64, firstBlock)
+	out.Uint("lastBlock", 64, lastBlock)
+	out.Uint("sampleCount", 32, count)
+
+	return out.Done()
+}
+
+// returnBps returns the magnitude of the price return from prev to curr in
+// basis points and whether the price went up. The price is the square of
+// sqrtPriceX96, so the magnitude is |curr² - prev²| * 10000 / prev². Samples
+// that are toggled off are priced at 1 to keep the division defined.
+func (c *VolatilityCircuit) returnBps(api *sdk.CircuitAPI, prev, curr sdk.Receipt, on sdk.Uint248) (magnitude, up sdk.Uint248) {
+	one := sdk.ConstUint248(1)
+	s0 := api.Uint248.Select(on, api.ToUint248(prev.Fields[1].Value), one)
+	s1 := api.Uint248.Select(on, api.ToUint248(curr.Fields[1].Value), one)
+	up = api.Uint248.Not(api.Uint248.IsLessThan(s1, s0))
+
+	u := api.Uint521
+	sq0 := u.Mul(api.ToUint521(s0), api.ToUint521(s0))
+	sq1 := u.Mul(api.ToUint521(s1), api.ToUint521(s1))
+	diff := u.Select(up, u.Sub(sq1, sq0), u.Sub(sq0, sq1))
+
+	ret, _ := u.Div(u.Mul(diff, sdk.ConstUint521(10000)), sq0)
+	return api.ToUint248(ret), up
+}
@@ -0,0 +1,61 @@
+package circuits
+
+import (
+	"math/big"
+	"testing"
+
+	"prover/outputs"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestVolatilityCircuit(t *testing.T) {
+	receipts := loadReceipts(t)
+	swap := func(n byte) sdk.ReceiptData {
+		return receipts[common.BigToHash(big.NewInt(int64(n)))].swapData(t, 0)
+	}
+	params := Params{
+		PoolManager: common.HexToAddress("0x000000000004444c5dc75cB358380D2e3dE08A90"),
+		PoolId:      common.HexToHash("0x7777777777777777777777777777777777777777777777777777777777777777"),
+	}
+	// 0xc1 to 0xc8 sample the pool every 100 blocks
+	series := func(txs ...byte) []sdk.ReceiptData {
+		var samples []sdk.ReceiptData
+		for _, n := range txs {
+			samples = append(samples, swap(n))
+		}
+		return samples
+	}
+
+	out, err := prove(t, &VolatilityCircuit{}, NewVolatilityCircuit(params), outputs.DecodeVolatilityOutput, series(0xc1, 0xc2, 0xc3, 0xc4, 0xc5, 0xc6, 0xc7, 0xc8)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.HistoricalVolatilityBps.Int64() != 144 || out.RelevantTimestamp.Sign() != 0 || out.PoolId != params.PoolId ||
+		out.FirstBlock != 19002000 || out.LastBlock != 19002700 || out.SampleCount != 8 {
+		t.Errorf("unexpected output %+v", out)
+	}
+
+	wrongPool := params
+	wrongPool.PoolId = common.HexToHash("0x01")
+	for name, c := range map[string]struct {
+		params  Params
+		samples []sdk.ReceiptData
+	}{
+		"wrong pool":      {wrongPool, series(0xc1, 0xc2, 0xc3, 0xc4, 0xc5, 0xc6, 0xc7, 0xc8)},
+		"not a swap":      {params, append(series(0xc1, 0xc2, 0xc3, 0xc4, 0xc5, 0xc6, 0xc7), receipts[common.BigToHash(big.NewInt(0xa2))].transferData(t, 0))},
+		"out of order":    {params, series(0xc1, 0xc2, 0xc3, 0xc5, 0xc4, 0xc6, 0xc7, 0xc8)},
+		"sampled twice":   {params, series(0xc1, 0xc2, 0xc3, 0xc4, 0xc4, 0xc6, 0xc7, 0xc8)},
+		"single sample":   {params, series(0xc1)},
+		"too few":         {params, series(0xc1, 0xc2, 0xc3, 0xc4, 0xc5, 0xc6, 0xc7)},
+		"window too long": {params, series(0xc2, 0xc3, 0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9)},
+		// 0xca to 0xcb multiplies the price by 2^120, a return whose square
+		// does not fit Uint248
+		"return too large": {params, series(0xc1, 0xc2, 0xc3, 0xc4, 0xc5, 0xc6, 0xca, 0xcb)},
+	} {
+		if _, err = prove(t, &VolatilityCircuit{}, NewVolatilityCircuit(c.params), outputs.DecodeVolatilityOutput, c.samples...); err == nil {
+			t.Errorf("%s: expected the circuit to reject the receipts", name)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Command hookdata prints the hookData a hook verifies a proof from, given the
+// hex encoded proof and circuit output:
+//
+//	go run ./cmd/hookdata -hook BrevisVerificationHook -proof 0x... -output 0x...
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"prover/internal/hookdata"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var (
+	hookName = flag.String("hook", "", "the hook to build the hookData for, one of "+strings.Join(hookdata.HookNames(), ", "))
+	proofHex = flag.String("proof", "", "the hex encoded proof")
+	output   = flag.String("output", "", "the hex encoded circuit output")
+	verbose  = flag.Bool("v", false, "also print the decoded circuit output")
+)
+
+func main() {
+	flag.Parse()
+
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	hook, ok := hookdata.Hooks[*hookName]
+	if !ok {
+		return fmt.Errorf("unknown hook %q, expected one of %s", *hookName, strings.Join(hookdata.HookNames(), ", "))
+	}
+	proof, err := hexutil.Decode(*proofHex)
+	if err != nil {
+		return fmt.Errorf("invalid proof: %s", err.Error())
+	}
+	out, err := hexutil.Decode(*output)
+	if err != nil {
+		return fmt.Errorf("invalid output: %s", err.Error())
+	}
+
+	hookData, fields, err := hook.Build(proof, out)
+	if err != nil {
+		return err
+	}
+	if *verbose {
+		for _, f := range fields {
+			fmt.Fprintf(os.Stderr, "%s %s = %s\n", f.Type, f.Name, f.Text())
+		}
+	}
+	fmt.Println(hexutil.Encode(hookData))
+	return nil
+}
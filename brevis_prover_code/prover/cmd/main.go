@@ -1,29 +1,138 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
-	"prover/circuits"
+	"prover/internal"
+	"prover/internal/auth"
+	"prover/internal/config"
+	"prover/internal/metrics"
+	"prover/internal/service"
 
-	"github.com/brevis-network/brevis-sdk/sdk/prover"
+	"google.golang.org/grpc"
 )
 
-var port = flag.Uint("port", 33247, "the port to start the service at")
+var (
+	configFile = flag.String("config", "", "the YAML config file, see configs/prover.yaml")
+	port       = flag.Uint("port", 0, "the port to start the service at, overrides the config")
+	configPort = flag.Uint("config-port", 0, "the port to serve the circuit configuration API at, overrides the config")
+	rpcURL     = flag.String("rpc", "", "the RPC endpoint of the chain, e.g. a cmd/mockrpc server, overrides the config")
+)
 
 func main() {
 	flag.Parse()
 
-	proverService, err := prover.NewService(&circuits.AppCircuit{}, prover.ServiceConfig{
-		SetupDir: "$HOME/circuitOut",
-		SrsDir:   "$HOME/kzgsrs",
-		RpcURL:   "https://eth.llamarpc.com",
-		ChainId:  1,
-	})
+	// Flags take precedence over the environment, which takes precedence over
+	// the config file
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if *port != 0 {
+		cfg.Port = *port
+	}
+	if *configPort != 0 {
+		cfg.ConfigPort = *configPort
+	}
+	if *rpcURL != "" {
+		cfg.RpcURL = *rpcURL
+	}
+	if err = cfg.Validate(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// Measure the RPC calls to the chains by sending them through local
+	// proxies of the endpoints
+	serviceConfig := cfg.ServiceConfig()
+	for i, c := range serviceConfig.Chains {
+		proxy, err := metrics.NewRPCProxy(c.RpcURL, strconv.FormatUint(c.ChainId, 10))
+		if err != nil {
+			fmt.Printf(">> not measuring the RPC calls to chain %d: %s\n", c.ChainId, err.Error())
+			continue
+		}
+		proxyURL, err := proxy.Start()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer proxy.Close()
+		serviceConfig.Chains[i].RpcURL = proxyURL
+	}
+
+	proverService, err := service.New(cfg.InitialProfiles(), serviceConfig)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-	proverService.Serve("", *port)
+
+	profileChanges, unsubscribe := proverService.Subscribe()
+	defer unsubscribe()
+	go func() {
+		for snapshot := range profileChanges {
+			fmt.Printf(">> profiles at revision %d, %d served, default %s\n", snapshot.Revision, len(snapshot.Profiles), snapshot.Default)
+		}
+	}()
+
+	authenticator, err := auth.New(cfg.AuthKeys())
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if authenticator == nil {
+		fmt.Println(">> no API keys configured, accepting unauthenticated requests")
+	}
+	audit, err := auth.OpenAuditLog(cfg.AuditLogPath())
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer audit.Close()
+	registry, err := cfg.TokenRegistry()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer registry.Close()
+
+	api := &internal.API{Prover: proverService, Auth: authenticator, Audit: audit, Tokens: registry}
+	configServer := internal.NewServer(fmt.Sprintf(":%d", cfg.ConfigPort), api)
+	go func() {
+		fmt.Println(">> serving config API at port", cfg.ConfigPort)
+		if err := configServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Println("config server crashed", err)
+			os.Exit(1)
+		}
+	}()
+
+	go func() {
+		if err := proverService.Serve("", cfg.Port, grpc.UnaryInterceptor(authenticator.UnaryInterceptor(auth.RoleRead))); err != nil {
+			fmt.Println("prover server crashed", err)
+			os.Exit(1)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	fmt.Println(">> shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := configServer.Shutdown(shutdownCtx); err != nil {
+		fmt.Println("failed to shut down config server:", err)
+	}
+	if err := proverService.Shutdown(shutdownCtx); err != nil {
+		fmt.Println("failed to shut down prover server:", err)
+	}
 }
@@ -0,0 +1,65 @@
+// Command mockrpc serves a scenario file over Ethereum JSON-RPC, so the prover
+// can run without a live chain:
+//
+//	go run ./cmd/mockrpc -scenario scenarios/usdc_usdt.yaml
+//	go run ./cmd -rpc http://localhost:8545
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"prover/internal/mockrpc"
+)
+
+var (
+	scenario = flag.String("scenario", "scenarios/usdc_usdt.yaml", "the YAML or JSON scenario file to serve")
+	port     = flag.Uint("port", 8545, "the port to serve JSON-RPC at")
+)
+
+func main() {
+	flag.Parse()
+
+	s, err := mockrpc.LoadScenario(*scenario)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	handler, err := mockrpc.New(s)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer handler.Close()
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", *port),
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		fmt.Printf(">> serving %s (chain %d, %d blocks) at port %d\n", *scenario, s.ChainId, len(s.Blocks), *port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Println("mock RPC server crashed", err)
+			os.Exit(1)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	fmt.Println(">> shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		fmt.Println("failed to shut down mock RPC server:", err)
+	}
+}
@@ -0,0 +1,62 @@
+// Command outputgen generates the Solidity libraries and Go decoders for the
+// circuit outputs. Run it after changing what a circuit outputs:
+//
+//	go run ./cmd/outputgen
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"prover/circuits"
+	"prover/internal/outputgen"
+)
+
+var (
+	solDir = flag.String("sol", "../../src/lib/circuits", "the directory to write the Solidity libraries to")
+	goDir  = flag.String("go", "outputs", "the directory to write the Go decoders to")
+)
+
+func main() {
+	flag.Parse()
+
+	if err := generate(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func generate() error {
+	for _, dir := range []string{*solDir, *goDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	pkg := filepath.Base(*goDir)
+
+	for _, c := range circuits.OutputCircuits() {
+		schema := c.OutputSchema()
+
+		sol, err := outputgen.Solidity(schema)
+		if err != nil {
+			return err
+		}
+		solFile := filepath.Join(*solDir, schema.Name+"Output.sol")
+		if err = os.WriteFile(solFile, sol, 0644); err != nil {
+			return err
+		}
+
+		src, err := outputgen.Go(schema, pkg)
+		if err != nil {
+			return err
+		}
+		goFile := filepath.Join(*goDir, outputgen.GoFileName(schema))
+		if err = os.WriteFile(goFile, src, 0644); err != nil {
+			return err
+		}
+		fmt.Println("generated", solFile, goFile)
+	}
+	return nil
+}
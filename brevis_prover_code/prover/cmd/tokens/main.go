@@ -0,0 +1,91 @@
+// Command tokens lists the tokens and pools the token registry knows for a
+// chain, or prints the profile settings of a pair for the prover config:
+//
+//	go run ./cmd/tokens -chain base
+//	go run ./cmd/tokens -chain base -min-volume 500 USDC/WETH
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"prover/tokens"
+)
+
+var (
+	chainName = flag.String("chain", "ethereum", "the chain, by name or id")
+	file      = flag.String("tokens", "", "a JSON token registry extending the built-in one, e.g. configs/tokens.json")
+	minVolume = flag.String("min-volume", "0", "the minimum volume of the pair in tokens of token 1, e.g. 500")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [TOKEN1/TOKEN2]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	registry, err := tokens.Load(*file)
+	if err != nil {
+		return err
+	}
+	chainId, err := registry.ChainID(*chainName)
+	if err != nil {
+		return err
+	}
+
+	switch flag.NArg() {
+	case 0:
+		list(registry, chainId)
+		return nil
+	case 1:
+		return printPair(registry, chainId, flag.Arg(0))
+	default:
+		flag.Usage()
+		os.Exit(2)
+		return nil
+	}
+}
+
+func list(registry *tokens.Registry, chainId uint64) {
+	fmt.Printf("chain %d (%s)\n", chainId, registry.ChainName(chainId))
+	for _, t := range registry.Tokens(chainId) {
+		fmt.Printf("  %-8s %s  %2d decimals\n", t.Symbol, t.Address.Hex(), t.Decimals)
+	}
+	for _, p := range registry.Pools(chainId) {
+		fmt.Printf("  pool %s fee %d tick spacing %d: %s\n", p.Pair, p.Fee, p.TickSpacing, p.ID().Hex())
+	}
+}
+
+// printPair prints the settings of the pair in the format of the prover config
+func printPair(registry *tokens.Registry, chainId uint64, name string) error {
+	pair, err := registry.Pair(chainId, name)
+	if err != nil {
+		return err
+	}
+	volume, err := tokens.ParseUnits(*minVolume, pair.Token1.Decimals)
+	if err != nil {
+		return fmt.Errorf("invalid minimum volume: %s", err.Error())
+	}
+
+	fmt.Printf("chain_id: %d\n", chainId)
+	fmt.Println("profile:")
+	fmt.Printf("  token1_address: %s  # %s\n", pair.Token1.Address.Hex(), pair.Token1.Symbol)
+	fmt.Printf("  token2_address: %s  # %s\n", pair.Token2.Address.Hex(), pair.Token2.Symbol)
+	fmt.Printf("  minimum_volume: %s  # %s %s\n", volume, tokens.FormatUnits(volume, pair.Token1.Decimals), pair.Token1.Symbol)
+	fmt.Printf("  token1_decimals: %d\n", pair.Token1.Decimals)
+	fmt.Printf("  token2_decimals: %d\n", pair.Token2.Decimals)
+	if pair.Pool != nil {
+		fmt.Printf("  pool_manager: %s\n", pair.Pool.Manager.Hex())
+		fmt.Printf("  pool_id: %s  # %s fee %d\n", pair.Pool.ID().Hex(), pair.Pool.Pair, pair.Pool.Fee)
+	}
+	return nil
+}
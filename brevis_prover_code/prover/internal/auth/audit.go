@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// AuditLog appends an entry for every configuration change to a file, one
+// JSON object per line. A nil AuditLog records nothing.
+type AuditLog struct {
+	f    *os.File
+	lock sync.Mutex
+}
+
+// AuditEntry records who changed what
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// Caller is the id of the API key of the request, RemoteAddr where it
+	// came from
+	Caller     string `json:"caller"`
+	RemoteAddr string `json:"remote_addr"`
+	// Action is the kind of change to Target, e.g. a profile id. Old is nil
+	// if the target did not exist before.
+	Action string      `json:"action"`
+	Target string      `json:"target"`
+	Old    interface{} `json:"old"`
+	New    interface{} `json:"new"`
+}
+
+// OpenAuditLog opens the audit log at path, creating it if needed
+func OpenAuditLog(path string) (*AuditLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %s", err.Error())
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %s", err.Error())
+	}
+	return &AuditLog{f: f}, nil
+}
+
+// Record appends the entry and syncs it to disk. The entry's time defaults to
+// now.
+func (l *AuditLog) Record(e AuditEntry) error {
+	if l == nil {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if _, err = l.f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return l.f.Sync()
+}
+
+// Close closes the audit log file
+func (l *AuditLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.f.Close()
+}
@@ -0,0 +1,256 @@
+// Package auth authenticates the callers of the prover's APIs by API key or
+// HMAC signature, authorizes them by role and limits their request rate
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Role is the permission of an API key
+type Role string
+
+const (
+	// RoleRead may read the configuration and request proofs
+	RoleRead Role = "read"
+	// RoleAdmin may also change the configuration
+	RoleAdmin Role = "admin"
+)
+
+// Valid returns whether the role is known
+func (r Role) Valid() bool {
+	return r == RoleRead || r == RoleAdmin
+}
+
+func (r Role) allows(required Role) bool {
+	return r == RoleAdmin || r == required
+}
+
+// Key is an API key. Callers send the secret as a bearer token, or sign their
+// requests with it.
+type Key struct {
+	ID     string
+	Secret string
+	Role   Role
+	// RateLimit is the number of requests per minute the key may make, with
+	// bursts up to the same number. Zero means unlimited.
+	RateLimit int
+}
+
+// Anonymous is the caller of requests to APIs without keys
+const Anonymous = "anonymous"
+
+// maxClockSkew is how far the timestamp of a signed request may be off
+const maxClockSkew = 5 * time.Minute
+
+// Headers of HMAC signed requests. The signature is the hex encoded
+// HMAC-SHA256 of the method, the path with the query, the timestamp and the
+// body, separated by newlines, with the key's secret. Each signature is
+// accepted once, so a request sent again needs a new timestamp.
+const (
+	KeyIdHeader     = "X-Key-Id"
+	TimestampHeader = "X-Timestamp"
+	SignatureHeader = "X-Signature"
+)
+
+var (
+	errUnauthenticated = errors.New("missing or invalid credentials")
+	errRateLimited     = errors.New("rate limit exceeded")
+)
+
+// Authenticator checks the credentials of requests against the API keys. A
+// nil Authenticator lets every request through as Anonymous.
+type Authenticator struct {
+	keys map[string]*key
+	now  func() time.Time
+
+	// signatures of the accepted signed requests by when their timestamp
+	// expires, so they cannot be replayed until then
+	signatures map[string]time.Time
+	lock       sync.Mutex
+}
+
+type key struct {
+	Key
+	// token bucket of the rate limit
+	tokens  float64
+	updated time.Time
+	lock    sync.Mutex
+}
+
+// New returns an authenticator for the keys, or nil if there are none
+func New(keys []Key) (*Authenticator, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	a := &Authenticator{keys: make(map[string]*key), now: time.Now, signatures: make(map[string]time.Time)}
+	for _, k := range keys {
+		if k.ID == "" || k.Secret == "" {
+			return nil, errors.New("API keys need an id and a secret")
+		}
+		if !k.Role.Valid() {
+			return nil, fmt.Errorf("API key %s has unknown role %q", k.ID, k.Role)
+		}
+		if k.RateLimit < 0 {
+			return nil, fmt.Errorf("API key %s has a negative rate limit", k.ID)
+		}
+		if _, ok := a.keys[k.ID]; ok {
+			return nil, fmt.Errorf("API key %s is configured twice", k.ID)
+		}
+		a.keys[k.ID] = &key{Key: k, tokens: float64(k.RateLimit)}
+	}
+	return a, nil
+}
+
+// bearer returns the key with the secret
+func (a *Authenticator) bearer(secret string) *key {
+	var found *key
+	// compare with every key so the timing does not reveal which matched
+	for _, k := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(k.Secret), []byte(secret)) == 1 {
+			found = k
+		}
+	}
+	return found
+}
+
+// signed returns the key that signed the request. The body is read and
+// replaced.
+func (a *Authenticator) signed(r *http.Request) (*key, error) {
+	k, ok := a.keys[r.Header.Get(KeyIdHeader)]
+	if !ok {
+		return nil, errUnauthenticated
+	}
+	timestamp := r.Header.Get(TimestampHeader)
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || math.Abs(a.now().Sub(time.Unix(unix, 0)).Seconds()) > maxClockSkew.Seconds() {
+		return nil, errUnauthenticated
+	}
+	signature, err := hex.DecodeString(r.Header.Get(SignatureHeader))
+	if err != nil {
+		return nil, errUnauthenticated
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if !hmac.Equal(signature, Sign(k.Secret, r.Method, r.URL.RequestURI(), timestamp, body)) {
+		return nil, errUnauthenticated
+	}
+	if !a.firstUse(signature, time.Unix(unix, 0)) {
+		return nil, errUnauthenticated
+	}
+	return k, nil
+}
+
+// firstUse records the signature of a request with the timestamp and returns
+// whether it was not used before. Signatures are forgotten once their
+// timestamp is too old to be accepted anyway.
+func (a *Authenticator) firstUse(signature []byte, timestamp time.Time) bool {
+	now := a.now()
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for s, expires := range a.signatures {
+		if now.After(expires) {
+			delete(a.signatures, s)
+		}
+	}
+	if _, ok := a.signatures[string(signature)]; ok {
+		return false
+	}
+	a.signatures[string(signature)] = timestamp.Add(maxClockSkew)
+	return true
+}
+
+// Sign returns the signature of a request
+func Sign(secret, method, uri, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n", method, uri, timestamp)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// allow takes a token from the key's rate limit bucket
+func (k *key) allow(now time.Time) bool {
+	if k.RateLimit == 0 {
+		return true
+	}
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	limit := float64(k.RateLimit)
+	k.tokens = math.Min(limit, k.tokens+now.Sub(k.updated).Minutes()*limit)
+	k.updated = now
+	if k.tokens < 1 {
+		return false
+	}
+	k.tokens--
+	return true
+}
+
+// authorize checks that the caller's key has the role and is within its rate
+// limit. It returns the HTTP status of rejected requests.
+func (a *Authenticator) authorize(k *key, role Role) (int, error) {
+	if k == nil {
+		return http.StatusUnauthorized, errUnauthenticated
+	}
+	if !k.Role.allows(role) {
+		return http.StatusForbidden, fmt.Errorf("API key %s lacks the %s role", k.ID, role)
+	}
+	if !k.allow(a.now()) {
+		return http.StatusTooManyRequests, errRateLimited
+	}
+	return http.StatusOK, nil
+}
+
+// Authenticate returns the request with the caller's key id in its context if
+// the caller has the role. Otherwise it returns the HTTP status of the
+// rejection and why. Callers authenticate with an Authorization: Bearer header
+// or by signing the request.
+func (a *Authenticator) Authenticate(r *http.Request, role Role) (*http.Request, int, error) {
+	if a == nil {
+		return r.WithContext(WithCaller(r.Context(), Anonymous)), http.StatusOK, nil
+	}
+	var k *key
+	if secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		k = a.bearer(secret)
+	} else if r.Header.Get(SignatureHeader) != "" {
+		var err error
+		if k, err = a.signed(r); err != nil && !errors.Is(err, errUnauthenticated) {
+			return nil, http.StatusBadRequest, err
+		}
+	}
+	if status, err := a.authorize(k, role); err != nil {
+		return nil, status, err
+	}
+	return r.WithContext(WithCaller(r.Context(), k.ID)), http.StatusOK, nil
+}
+
+type callerKey struct{}
+
+// WithCaller returns a context of a request by the caller
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// Caller returns the id of the API key that authenticated the request of the
+// context, Anonymous if none did
+func Caller(ctx context.Context) string {
+	if caller, ok := ctx.Value(callerKey{}).(string); ok {
+		return caller
+	}
+	return Anonymous
+}
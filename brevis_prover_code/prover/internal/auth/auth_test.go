@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func newAuthenticator(t *testing.T, now *time.Time) *Authenticator {
+	a, err := New([]Key{
+		{ID: "bot", Secret: "bot-secret", Role: RoleRead, RateLimit: 2},
+		{ID: "ops", Secret: "ops-secret", Role: RoleAdmin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.now = func() time.Time { return *now }
+	return a
+}
+
+func TestAuthenticate(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	a := newAuthenticator(t, &now)
+
+	bearer := func(secret string) *http.Request {
+		r := httptest.NewRequest("GET", "/api/config", nil)
+		r.Header.Set("Authorization", "Bearer "+secret)
+		return r
+	}
+	signed := func(id, secret string, timestamp time.Time, body string) *http.Request {
+		r := httptest.NewRequest("POST", "/api/config?x=1", strings.NewReader(body))
+		ts := strconv.FormatInt(timestamp.Unix(), 10)
+		r.Header.Set(KeyIdHeader, id)
+		r.Header.Set(TimestampHeader, ts)
+		r.Header.Set(SignatureHeader, hex.EncodeToString(Sign(secret, "POST", "/api/config?x=1", ts, []byte(body))))
+		return r
+	}
+
+	tests := []struct {
+		name   string
+		req    *http.Request
+		role   Role
+		status int
+		caller string
+	}{
+		{"bearer", bearer("ops-secret"), RoleAdmin, http.StatusOK, "ops"},
+		{"admin reads", bearer("ops-secret"), RoleRead, http.StatusOK, "ops"},
+		{"read key changes", bearer("bot-secret"), RoleAdmin, http.StatusForbidden, ""},
+		{"wrong secret", bearer("bot"), RoleRead, http.StatusUnauthorized, ""},
+		{"no credentials", httptest.NewRequest("GET", "/", nil), RoleRead, http.StatusUnauthorized, ""},
+		{"signed", signed("ops", "ops-secret", now.Add(time.Minute), `{"profile":"x"}`), RoleAdmin, http.StatusOK, "ops"},
+		{"wrong signature", signed("ops", "bot-secret", now, `{}`), RoleAdmin, http.StatusUnauthorized, ""},
+		{"stale signature", signed("ops", "ops-secret", now.Add(-time.Hour), `{}`), RoleAdmin, http.StatusUnauthorized, ""},
+		{"unknown key", signed("dev", "ops-secret", now, `{}`), RoleAdmin, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		r, status, err := a.Authenticate(tt.req, tt.role)
+		if status != tt.status {
+			t.Errorf("%s: got status %d (%v), want %d", tt.name, status, err, tt.status)
+			continue
+		}
+		if tt.caller != "" && Caller(r.Context()) != tt.caller {
+			t.Errorf("%s: got caller %s, want %s", tt.name, Caller(r.Context()), tt.caller)
+		}
+	}
+
+	// A signed request is accepted once until its timestamp expires
+	replayed := func() *http.Request { return signed("ops", "ops-secret", now, `{"profile":"y"}`) }
+	if _, status, _ := a.Authenticate(replayed(), RoleAdmin); status != http.StatusOK {
+		t.Errorf("got status %d for a signed request", status)
+	}
+	if _, status, _ := a.Authenticate(replayed(), RoleAdmin); status != http.StatusUnauthorized {
+		t.Errorf("got status %d for a replayed request", status)
+	}
+	later := now.Add(maxClockSkew + time.Second)
+	a.now = func() time.Time { return later }
+	if _, status, _ := a.Authenticate(replayed(), RoleAdmin); status != http.StatusUnauthorized {
+		t.Errorf("got status %d for a replayed request after it expired", status)
+	}
+	if _, status, _ := a.Authenticate(signed("ops", "ops-secret", later, `{"profile":"y"}`), RoleAdmin); status != http.StatusOK {
+		t.Errorf("got status %d for the request signed again", status)
+	}
+	a.now = func() time.Time { return now }
+
+	// Signed bodies can still be read by the handler
+	r, _, _ := a.Authenticate(signed("ops", "ops-secret", now, "body"), RoleAdmin)
+	if body, _ := io.ReadAll(r.Body); string(body) != "body" {
+		t.Errorf("got body %q", body)
+	}
+
+	// The read key may make two requests per minute
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if _, status, _ := a.Authenticate(bearer("bot-secret"), RoleRead); status != want {
+			t.Errorf("request %d: got status %d, want %d", i, status, want)
+		}
+	}
+	now = now.Add(30 * time.Second)
+	if _, status, _ := a.Authenticate(bearer("bot-secret"), RoleRead); status != http.StatusOK {
+		t.Errorf("got status %d after the bucket refilled", status)
+	}
+
+	// Without keys every request is accepted
+	var none *Authenticator
+	if r, status, _ := none.Authenticate(httptest.NewRequest("GET", "/", nil), RoleAdmin); status != http.StatusOK || Caller(r.Context()) != Anonymous {
+		t.Errorf("got status %d for an API without keys", status)
+	}
+}
+
+func TestNewRejectsInvalidKeys(t *testing.T) {
+	for name, keys := range map[string][]Key{
+		"no secret":  {{ID: "bot", Role: RoleRead}},
+		"bad role":   {{ID: "bot", Secret: "s", Role: "write"}},
+		"negative":   {{ID: "bot", Secret: "s", Role: RoleRead, RateLimit: -1}},
+		"duplicated": {{ID: "bot", Secret: "s", Role: RoleRead}, {ID: "bot", Secret: "t", Role: RoleRead}},
+	} {
+		if _, err := New(keys); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestUnaryInterceptor(t *testing.T) {
+	now := time.Now()
+	interceptor := newAuthenticator(t, &now).UnaryInterceptor(RoleAdmin)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return Caller(ctx), nil
+	}
+	call := func(secret string) (interface{}, error) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+secret))
+		return interceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+	}
+
+	if caller, err := call("ops-secret"); err != nil || caller != "ops" {
+		t.Errorf("got caller %v, %v", caller, err)
+	}
+	if _, err := call("bot-secret"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected permission denied, got %v", err)
+	}
+	if _, err := call("nope"); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected unauthenticated, got %v", err)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "audit.log")
+	for i := 0; i < 2; i++ {
+		l, err := OpenAuditLog(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = l.Record(AuditEntry{Caller: "ops", Action: "update_profile", Target: "usdc-usdt", New: map[string]int{"version": i + 1}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.Close()
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []AuditEntry
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		var e AuditEntry
+		if err = json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) != 2 || entries[1].Caller != "ops" || entries[1].Time.IsZero() || entries[1].Old != nil {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+}
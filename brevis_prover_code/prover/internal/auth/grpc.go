@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryInterceptor returns a GRPC interceptor passing calls from callers with
+// the role on. Callers authenticate with an API key in the authorization
+// metadata, which the REST gateway fills from the Authorization header.
+// Signed requests are only supported by HTTP APIs.
+func (a *Authenticator) UnaryInterceptor(role Role) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if a == nil {
+			return handler(WithCaller(ctx, Anonymous), req)
+		}
+		var k *key
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			for _, v := range md.Get("authorization") {
+				if secret, ok := strings.CutPrefix(v, "Bearer "); ok {
+					k = a.bearer(secret)
+				}
+			}
+		}
+		if httpStatus, err := a.authorize(k, role); err != nil {
+			return nil, status.Error(grpcCode(httpStatus), err.Error())
+		}
+		return handler(WithCaller(ctx, k.ID), req)
+	}
+}
+
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	default:
+		return codes.Unauthenticated
+	}
+}
@@ -0,0 +1,371 @@
+// Package config loads the configuration of the prover binary from a YAML file
+// and PROVER_* environment variables
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"prover/circuits"
+	"prover/internal/auth"
+	"prover/internal/service"
+	"prover/tokens"
+
+	"github.com/ethereum/go-ethereum/common"
+	"gopkg.in/yaml.v3"
+)
+
+// Config configures the prover binary. Directories may reference environment
+// variables such as $HOME.
+type Config struct {
+	// RpcURL is the JSON-RPC endpoint of the primary source chain. Its profile
+	// is the default for requests that do not name a chain.
+	RpcURL  string `yaml:"rpc_url"`
+	ChainId uint64 `yaml:"chain_id"`
+	// SetupDir stores the circuit profiles, their proving and verifying keys,
+	// the cached proofs and the job journal, SrsDir the downloaded SRS files
+	SetupDir string `yaml:"setup_dir"`
+	SrsDir   string `yaml:"srs_dir"`
+	// Port serves the prover API, ConfigPort the circuit configuration API
+	Port       uint `yaml:"port"`
+	ConfigPort uint `yaml:"config_port"`
+	// ProveWorkers is the number of proofs generated at once
+	ProveWorkers int `yaml:"prove_workers"`
+	// Profile is the circuit profile the primary chain starts with when
+	// SetupDir stores none for it yet
+	Profile Profile `yaml:"profile"`
+	// Chains are additional source chains served next to the primary one
+	Chains []Chain `yaml:"chains"`
+	// Auth configures the API keys of the prover and configuration APIs
+	Auth Auth `yaml:"auth"`
+	// Tokens configures the token registry the configuration API describes
+	// tokens and resolves pairs such as USDC/WETH with
+	Tokens Tokens `yaml:"tokens"`
+}
+
+// Tokens configures the token registry
+type Tokens struct {
+	// File is a JSON token registry extending the one built into the
+	// prover, see configs/tokens.json
+	File string `yaml:"file"`
+	// Lookup looks up tokens missing from the file on their chain
+	Lookup bool `yaml:"lookup"`
+}
+
+// Auth configures who may call the APIs. Without keys every request is
+// accepted.
+type Auth struct {
+	Keys []APIKey `yaml:"keys"`
+	// AuditLog is the file configuration changes are recorded in,
+	// setup_dir/audit.log if empty
+	AuditLog string `yaml:"audit_log"`
+}
+
+// APIKey configures an API key. The secret may reference environment
+// variables, e.g. $PROVER_BOT_KEY, to keep it out of the config file.
+type APIKey struct {
+	ID     string `yaml:"id"`
+	Secret string `yaml:"secret"`
+	// Role is read or admin
+	Role string `yaml:"role"`
+	// RateLimit is the number of requests per minute, 0 for unlimited
+	RateLimit int `yaml:"rate_limit"`
+}
+
+// Chain configures an additional source chain. Its RPC endpoint can be
+// overridden with PROVER_RPC_URL_<chain id>.
+type Chain struct {
+	ChainId uint64 `yaml:"chain_id"`
+	RpcURL  string `yaml:"rpc_url"`
+	// Profile is the circuit profile the chain starts with
+	Profile Profile `yaml:"profile"`
+}
+
+// Profile configures the initial circuit profile. Its chain is the configured
+// chain and its version is 1.
+type Profile struct {
+	Name           string         `yaml:"name"`
+	Kind           string         `yaml:"kind"`
+	Token1Address  common.Address `yaml:"token1_address"`
+	Token2Address  common.Address `yaml:"token2_address"`
+	MinimumVolume  *big.Int       `yaml:"minimum_volume"`
+	Token1Decimals uint8          `yaml:"token1_decimals"`
+	Token2Decimals uint8          `yaml:"token2_decimals"`
+	PoolManager    common.Address `yaml:"pool_manager"`
+	PoolId         common.Hash    `yaml:"pool_id"`
+}
+
+// Default returns the configuration the prover uses without a config file:
+// the default profile on mainnet
+func Default() Config {
+	p := circuits.DefaultProfile()
+	return Config{
+		RpcURL:     "https://eth.llamarpc.com",
+		ChainId:    p.ChainId,
+		SetupDir:   "$HOME/circuitOut",
+		SrsDir:     "$HOME/kzgsrs",
+		Port:       33247,
+		ConfigPort: 8080,
+
+		ProveWorkers: 1,
+		Profile: Profile{
+			Name:           p.Name,
+			Kind:           p.Kind,
+			Token1Address:  p.Params.Token1Addr,
+			Token2Address:  p.Params.Token2Addr,
+			MinimumVolume:  p.Params.MinVolume,
+			Token1Decimals: p.Params.Token1Decimals,
+			Token2Decimals: p.Params.Token2Decimals,
+			PoolManager:    p.Params.PoolManager,
+			PoolId:         p.Params.PoolId,
+		},
+	}
+}
+
+// Load returns the default configuration overridden by the file at path, if
+// path is not empty, and then by the environment. A profile in the file
+// replaces the default profile as a whole, so fields it omits are zero rather
+// than those of the default tokens. The result is not validated.
+func Load(path string) (Config, error) {
+	c := Default()
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to read config: %s", err.Error())
+		}
+		defer f.Close()
+		// Reject unknown fields so misspelled settings do not go unnoticed
+		dec := yaml.NewDecoder(f)
+		dec.KnownFields(true)
+		c.Profile = Profile{}
+		if err = dec.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+			return Config{}, fmt.Errorf("failed to parse config %s: %s", path, err.Error())
+		}
+		if c.Profile == (Profile{}) {
+			c.Profile = Default().Profile
+		}
+	}
+	if err := c.applyEnv(os.LookupEnv); err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
+
+// envVars are the environment variables overriding the configuration
+var envVars = []struct {
+	name string
+	set  func(c *Config, v string) error
+}{
+	{"PROVER_RPC_URL", func(c *Config, v string) error { c.RpcURL = v; return nil }},
+	{"PROVER_CHAIN_ID", func(c *Config, v string) (err error) { c.ChainId, err = strconv.ParseUint(v, 10, 64); return }},
+	{"PROVER_SETUP_DIR", func(c *Config, v string) error { c.SetupDir = v; return nil }},
+	{"PROVER_SRS_DIR", func(c *Config, v string) error { c.SrsDir = v; return nil }},
+	{"PROVER_PORT", func(c *Config, v string) error { return parsePort(&c.Port, v) }},
+	{"PROVER_CONFIG_PORT", func(c *Config, v string) error { return parsePort(&c.ConfigPort, v) }},
+	{"PROVER_PROVE_WORKERS", func(c *Config, v string) (err error) { c.ProveWorkers, err = strconv.Atoi(v); return }},
+	{"PROVER_AUDIT_LOG", func(c *Config, v string) error { c.Auth.AuditLog = v; return nil }},
+	{"PROVER_TOKENS_FILE", func(c *Config, v string) error { c.Tokens.File = v; return nil }},
+	{"PROVER_TOKENS_LOOKUP", func(c *Config, v string) (err error) { c.Tokens.Lookup, err = strconv.ParseBool(v); return }},
+	{"PROVER_PROFILE_NAME", func(c *Config, v string) error { c.Profile.Name = v; return nil }},
+	{"PROVER_PROFILE_KIND", func(c *Config, v string) error { c.Profile.Kind = v; return nil }},
+	{"PROVER_TOKEN1_ADDRESS", func(c *Config, v string) error { return parseAddress(&c.Profile.Token1Address, v) }},
+	{"PROVER_TOKEN2_ADDRESS", func(c *Config, v string) error { return parseAddress(&c.Profile.Token2Address, v) }},
+	{"PROVER_MINIMUM_VOLUME", func(c *Config, v string) error {
+		volume, ok := new(big.Int).SetString(v, 10)
+		if !ok {
+			return fmt.Errorf("invalid integer %q", v)
+		}
+		c.Profile.MinimumVolume = volume
+		return nil
+	}},
+}
+
+func parsePort(port *uint, v string) error {
+	p, err := strconv.ParseUint(v, 10, 16)
+	*port = uint(p)
+	return err
+}
+
+func parseAddress(addr *common.Address, v string) error {
+	if !common.IsHexAddress(v) {
+		return fmt.Errorf("invalid address %q", v)
+	}
+	*addr = common.HexToAddress(v)
+	return nil
+}
+
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	for _, env := range envVars {
+		v, ok := lookup(env.name)
+		if !ok {
+			continue
+		}
+		if err := env.set(c, v); err != nil {
+			return fmt.Errorf("invalid %s: %s", env.name, err.Error())
+		}
+	}
+	for i := range c.Chains {
+		if v, ok := lookup(fmt.Sprintf("PROVER_RPC_URL_%d", c.Chains[i].ChainId)); ok {
+			c.Chains[i].RpcURL = v
+		}
+	}
+	return nil
+}
+
+// Validate returns every problem with the configuration
+func (c Config) Validate() error {
+	var errs []error
+	if err := validateRpcURL(c.RpcURL); err != nil {
+		errs = append(errs, err)
+	}
+	if c.ChainId == 0 {
+		errs = append(errs, errors.New("chain_id is missing"))
+	}
+	if c.SetupDir == "" {
+		errs = append(errs, errors.New("setup_dir is missing"))
+	}
+	if c.SrsDir == "" {
+		errs = append(errs, errors.New("srs_dir is missing"))
+	}
+	if c.Port == 0 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port %d is out of range", c.Port))
+	}
+	if c.ConfigPort == 0 || c.ConfigPort > 65535 {
+		errs = append(errs, fmt.Errorf("config_port %d is out of range", c.ConfigPort))
+	}
+	if c.Port == c.ConfigPort {
+		errs = append(errs, fmt.Errorf("port and config_port are both %d", c.Port))
+	}
+	if c.ProveWorkers < 1 {
+		errs = append(errs, fmt.Errorf("prove_workers %d must be at least 1", c.ProveWorkers))
+	}
+	if err := c.Profile.profile(c.ChainId).Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("profile: %s", err.Error()))
+	}
+
+	// Profile versions are identified by name, so each chain needs its own
+	chains := map[uint64]bool{c.ChainId: true}
+	names := map[string]bool{c.Profile.Name: true}
+	for i, chain := range c.Chains {
+		if chain.ChainId == 0 {
+			errs = append(errs, fmt.Errorf("chains[%d]: chain_id is missing", i))
+		} else if chains[chain.ChainId] {
+			errs = append(errs, fmt.Errorf("chains[%d]: chain %d is configured twice", i, chain.ChainId))
+		}
+		chains[chain.ChainId] = true
+		if names[chain.Profile.Name] {
+			errs = append(errs, fmt.Errorf("chains[%d]: profile name %s is used by another chain", i, chain.Profile.Name))
+		}
+		names[chain.Profile.Name] = true
+		if err := validateRpcURL(chain.RpcURL); err != nil {
+			errs = append(errs, fmt.Errorf("chains[%d]: %s", i, err.Error()))
+		}
+		if err := chain.Profile.profile(chain.ChainId).Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("chains[%d]: profile: %s", i, err.Error()))
+		}
+	}
+	if _, err := auth.New(c.AuthKeys()); err != nil {
+		errs = append(errs, fmt.Errorf("auth: %s", err.Error()))
+	}
+	if _, err := tokens.Load(os.ExpandEnv(c.Tokens.File)); err != nil {
+		errs = append(errs, fmt.Errorf("tokens: %s", err.Error()))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func validateRpcURL(rpcURL string) error {
+	u, err := url.Parse(rpcURL)
+	if rpcURL == "" || err != nil || u.Host == "" {
+		return fmt.Errorf("rpc_url %q is not a URL", rpcURL)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "ws" && u.Scheme != "wss" {
+		return fmt.Errorf("rpc_url %q must be an http(s) or ws(s) URL", rpcURL)
+	}
+	return nil
+}
+
+// InitialProfiles returns the circuit profiles the chains start with, the
+// primary chain's first
+func (c Config) InitialProfiles() []circuits.Profile {
+	profiles := []circuits.Profile{c.Profile.profile(c.ChainId)}
+	for _, chain := range c.Chains {
+		profiles = append(profiles, chain.Profile.profile(chain.ChainId))
+	}
+	return profiles
+}
+
+func (p Profile) profile(chainId uint64) circuits.Profile {
+	return circuits.Profile{
+		Name:    p.Name,
+		Version: 1,
+		Kind:    p.Kind,
+		ChainId: chainId,
+		Params: circuits.Params{
+			Token1Addr:     p.Token1Address,
+			Token2Addr:     p.Token2Address,
+			MinVolume:      p.MinimumVolume,
+			Token1Decimals: p.Token1Decimals,
+			Token2Decimals: p.Token2Decimals,
+			PoolManager:    p.PoolManager,
+			PoolId:         p.PoolId,
+		},
+	}
+}
+
+// AuthKeys returns the API keys with the environment variables in their
+// secrets expanded
+func (c Config) AuthKeys() []auth.Key {
+	keys := make([]auth.Key, len(c.Auth.Keys))
+	for i, k := range c.Auth.Keys {
+		keys[i] = auth.Key{ID: k.ID, Secret: os.ExpandEnv(k.Secret), Role: auth.Role(k.Role), RateLimit: k.RateLimit}
+	}
+	return keys
+}
+
+// AuditLogPath returns the file configuration changes are recorded in
+func (c Config) AuditLogPath() string {
+	if c.Auth.AuditLog == "" {
+		return filepath.Join(os.ExpandEnv(c.SetupDir), "audit.log")
+	}
+	return os.ExpandEnv(c.Auth.AuditLog)
+}
+
+// TokenRegistry loads the token registry file and, if enabled, looks up the
+// tokens missing from it on the configured chains
+func (c Config) TokenRegistry() (*tokens.Registry, error) {
+	registry, err := tokens.Load(os.ExpandEnv(c.Tokens.File))
+	if err != nil || !c.Tokens.Lookup {
+		return registry, err
+	}
+	for _, chain := range c.ServiceConfig().Chains {
+		if err = registry.LookupOnChain(chain.ChainId, chain.RpcURL); err != nil {
+			registry.Close()
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+// ServiceConfig returns the configuration of the prover service
+func (c Config) ServiceConfig() service.Config {
+	chains := []service.Chain{{ChainId: c.ChainId, RpcURL: c.RpcURL}}
+	for _, chain := range c.Chains {
+		chains = append(chains, service.Chain{ChainId: chain.ChainId, RpcURL: chain.RpcURL})
+	}
+	return service.Config{
+		SetupDir: c.SetupDir,
+		SrsDir:   c.SrsDir,
+		Chains:   chains,
+
+		ProveWorkers: c.ProveWorkers,
+	}
+}
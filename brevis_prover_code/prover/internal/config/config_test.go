@@ -0,0 +1,128 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"prover/circuits"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "prover.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	// The example config spells out the defaults
+	example, err := Load("../../configs/prover.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(example, Default()) {
+		t.Errorf("example config %+v differs from the defaults %+v", example, Default())
+	}
+	if p := example.InitialProfiles(); len(p) != 1 || p[0].ID() != circuits.DefaultProfile().ID() {
+		t.Errorf("initial profiles are %+v", p)
+	}
+
+	path := writeConfig(t, `
+rpc_url: https://sepolia.example.org
+chain_id: 11155111
+profile:
+  name: sepolia-usdc
+  token1_address: 0x1c7D4B196Cb0C7B01d743Fbc6116a902379C7238
+  minimum_volume: 1000
+  token1_decimals: 6
+chains:
+  - chain_id: 10
+    rpc_url: https://optimism.example.org
+    profile:
+      name: op-usdc
+      token1_address: 0x0b2C639c533813f4Aa9D7837CAf62653d097Ff85
+      token2_address: 0x94b008aA00579c1307B0EF2c499aD98a8ce58e58
+      minimum_volume: 500000000
+      token1_decimals: 6
+      token2_decimals: 6
+`)
+	t.Setenv("PROVER_CHAIN_ID", "17000")
+	t.Setenv("PROVER_PORT", "9000")
+	t.Setenv("PROVER_PROVE_WORKERS", "2")
+	t.Setenv("PROVER_RPC_URL_10", "https://optimism.example.net")
+	t.Setenv("PROVER_TOKENS_FILE", "../../configs/tokens.json")
+	c, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if c.RpcURL != "https://sepolia.example.org" || c.ChainId != 17000 || c.Port != 9000 || c.ConfigPort != 8080 || c.ServiceConfig().ProveWorkers != 2 {
+		t.Errorf("unexpected config %+v", c)
+	}
+	p := c.InitialProfiles()[0]
+	if p.ID() != "sepolia-usdc-v1" || p.ChainId != 17000 || p.Params.MinVolume.Int64() != 1000 || p.Params.Token1Decimals != 6 {
+		t.Errorf("unexpected initial profile %+v", p)
+	}
+	// The profile replaces the default one, so it does not pick up the
+	// default USDT token 2
+	if p.Params.Token2Addr != (common.Address{}) || p.Params.Token2Decimals != 0 {
+		t.Errorf("initial profile %+v inherits the default token 2", p)
+	}
+
+	profiles := c.InitialProfiles()
+	chains := c.ServiceConfig().Chains
+	if len(profiles) != 2 || profiles[1].ID() != "op-usdc-v1" || profiles[1].ChainId != 10 {
+		t.Errorf("unexpected initial profiles %+v", profiles)
+	}
+	if len(chains) != 2 || chains[0].ChainId != 17000 || chains[1].ChainId != 10 || chains[1].RpcURL != "https://optimism.example.net" {
+		t.Errorf("unexpected chains %+v", chains)
+	}
+	registry, err := c.TokenRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, err := registry.Token(context.Background(), 10, profiles[1].Params.Token1Addr); err != nil || token.Symbol != "USDC" {
+		t.Errorf("got token %+v, %v", token, err)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	if _, err := Load(writeConfig(t, "rpc: https://example.org\n")); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+	t.Setenv("PROVER_TOKEN1_ADDRESS", "0x1234")
+	if _, err := Load(""); err == nil || !strings.Contains(err.Error(), "PROVER_TOKEN1_ADDRESS") {
+		t.Errorf("expected an error naming the variable, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := Default()
+	c.RpcURL = "localhost:8545"
+	c.ChainId = 0
+	c.ConfigPort = c.Port
+	c.ProveWorkers = 0
+	c.Auth.Keys = []APIKey{{ID: "bot", Secret: "$PROVER_TEST_UNSET_KEY", Role: "read"}}
+	c.Tokens.File = "does-not-exist.json"
+	c.Profile.MinimumVolume = nil
+	c.Chains = []Chain{{ChainId: 10, RpcURL: "https://optimism.example.org", Profile: Default().Profile}, {ChainId: 10}}
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("expected the config to be invalid")
+	}
+	for _, want := range []string{"rpc_url", "chain_id", "config_port", "prove_workers", "profile", "chains[1]: chain 10 is configured twice", "chains[0]: profile name usdc-usdt", "auth: API keys need an id and a secret", "tokens: failed to read token registry"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Package hookdata decodes packed circuit outputs and builds the hookData the
+// Uniswap v4 hooks verify Brevis proofs from
+package hookdata
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"prover/circuits"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Field is a decoded circuit output value. Value holds the Go type the ABI
+// encoder expects for Type: common.Address, bool, [32]byte, uint8 to uint64
+// for small unsigned integers and *big.Int for larger ones.
+type Field struct {
+	Name  string
+	Type  string
+	Value interface{}
+}
+
+// Text returns the value as a hex string for addresses and bytes32, and as a
+// decimal string otherwise
+func (f Field) Text() string {
+	switch v := f.Value.(type) {
+	case common.Address:
+		return v.Hex()
+	case [32]byte:
+		return common.Hash(v).Hex()
+	}
+	return fmt.Sprint(f.Value)
+}
+
+// MarshalJSON encodes the field with its value as text, so large integers
+// survive JSON decoders using floating point numbers
+func (f Field) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Name  string `json:"name"`
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}{f.Name, f.Type, f.Text()})
+}
+
+// Decode decodes the packed circuit output according to schema
+func Decode(schema circuits.OutputSchema, output []byte) ([]Field, error) {
+	if len(output) != schema.Size() {
+		return nil, fmt.Errorf("invalid %s output length %d, expected %d", schema.Name, len(output), schema.Size())
+	}
+	fields := make([]Field, 0, len(schema.Fields))
+	offset := 0
+	for _, f := range schema.Fields {
+		value, err := decodeValue(f.Type, output[offset:offset+f.Size])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s output field %s: %s", schema.Name, f.Name, err.Error())
+		}
+		fields = append(fields, Field{Name: f.Name, Type: f.Type, Value: value})
+		offset += f.Size
+	}
+	return fields, nil
+}
+
+func decodeValue(typ string, b []byte) (interface{}, error) {
+	switch typ {
+	case "address":
+		// Addresses padded to a word must have clean high bytes
+		if new(big.Int).SetBytes(b).BitLen() > 160 {
+			return nil, fmt.Errorf("value %x overflows address", b)
+		}
+		return common.BytesToAddress(b), nil
+	case "bool":
+		return new(big.Int).SetBytes(b).Sign() != 0, nil
+	case "bytes32":
+		return [32]byte(common.BytesToHash(b)), nil
+	}
+
+	bits, err := strconv.Atoi(strings.TrimPrefix(typ, "uint"))
+	if err != nil || !strings.HasPrefix(typ, "uint") {
+		return nil, fmt.Errorf("unsupported type %s", typ)
+	}
+	v := new(big.Int).SetBytes(b)
+	if v.BitLen() > bits {
+		return nil, fmt.Errorf("value %s overflows %s", v, typ)
+	}
+	switch {
+	case bits <= 8:
+		return uint8(v.Uint64()), nil
+	case bits <= 16:
+		return uint16(v.Uint64()), nil
+	case bits <= 32:
+		return uint32(v.Uint64()), nil
+	case bits <= 64:
+		return v.Uint64(), nil
+	}
+	return v, nil
+}
+
+// Hook is a hook verifying proofs of a circuit from its hookData
+type Hook struct {
+	Name string
+	// Circuit is the output schema of the circuit proving the public inputs.
+	// The hook decodes them with the circuit's generated Solidity library.
+	Circuit circuits.OutputSchema
+}
+
+// Hooks are the hooks hookData can be built for, by name
+var Hooks = map[string]Hook{
+	"BrevisVerificationHook": {
+		Name:    "BrevisVerificationHook",
+		Circuit: (&circuits.TradingVolumeCircuit{}).OutputSchema(),
+	},
+	"CombinedHook": {
+		Name:    "CombinedHook",
+		Circuit: (&circuits.VolatilityCircuit{}).OutputSchema(),
+	},
+	"ComprehensiveBotHook": {
+		Name:    "ComprehensiveBotHook",
+		Circuit: (&circuits.VolatilityCircuit{}).OutputSchema(),
+	},
+}
+
+// HookNames returns the names of all hooks, sorted
+func HookNames() []string {
+	names := make([]string, 0, len(Hooks))
+	for name := range Hooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Build decodes the circuit output and returns the hookData for the hook,
+// abi.encode(bytes proof, bytes publicInputs).
+//
+// The hooks verify keccak256(publicInputs) against the output commitment of
+// the Brevis proof, so publicInputs is the complete circuit output, which the
+// hook decodes with the circuit's generated library. Build checks that the
+// output decodes.
+func (h Hook) Build(proof, output []byte) (hookData []byte, fields []Field, err error) {
+	fields, err = Decode(h.Circuit, output)
+	if err != nil {
+		return nil, nil, err
+	}
+	hookData, err = Encode(proof, output)
+	return hookData, fields, err
+}
+
+// Encode returns abi.encode(bytes proof, bytes publicInputs)
+func Encode(proof, publicInputs []byte) ([]byte, error) {
+	bytesType, err := abi.NewType("bytes", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	args := abi.Arguments{{Name: "proof", Type: bytesType}, {Name: "publicInputs", Type: bytesType}}
+	return args.Pack(proof, publicInputs)
+}
@@ -0,0 +1,86 @@
+package hookdata
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"prover/outputs"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func word(v uint64) []byte {
+	return common.LeftPadBytes(new(big.Int).SetUint64(v).Bytes(), 32)
+}
+
+func tradingVolumeOutput(account common.Address) []byte {
+	var out []byte
+	out = append(out, common.LeftPadBytes(account.Bytes(), 32)...)
+	out = append(out, word(19000000)...)
+	out = append(out, word(500)...)
+	out = append(out, word(1700000000)...)
+	out = append(out, word(2500)...)
+	out = append(out, common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7").Bytes()...)
+	out = append(out, common.LeftPadBytes(big.NewInt(18999000).Bytes(), 8)...)
+	out = append(out, common.LeftPadBytes(big.NewInt(19000000).Bytes(), 8)...)
+	return out
+}
+
+func TestBuildBrevisVerificationHook(t *testing.T) {
+	account := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	output := tradingVolumeOutput(account)
+	proof := []byte{1, 2, 3}
+
+	hookData, fields, err := Hooks["BrevisVerificationHook"].Build(proof, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 8 || fields[0].Text() != account.Hex() || fields[6].Value != uint64(18999000) {
+		t.Fatalf("unexpected fields %v", fields)
+	}
+
+	// Decode the hookData the way the hook does
+	bytesType, _ := abi.NewType("bytes", "", nil)
+	decoded, err := abi.Arguments{{Type: bytesType}, {Type: bytesType}}.Unpack(hookData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded[0].([]byte), proof) || !bytes.Equal(decoded[1].([]byte), output) {
+		t.Fatal("hookData does not encode the proof and output")
+	}
+
+	// The hook decodes publicInputs with the generated library, whose Go twin
+	// is outputs.DecodeTradingVolumeOutput
+	got, err := outputs.DecodeTradingVolumeOutput(decoded[1].([]byte))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AccountAddr != account || got.BlockNum != 19000000 || got.Volume.Uint64() != 500 || got.HistoricalVolume.Uint64() != 2500 {
+		t.Fatalf("unexpected public inputs %+v", got)
+	}
+}
+
+func TestBuildRejectsInvalidOutput(t *testing.T) {
+	hook := Hooks["BrevisVerificationHook"]
+	output := tradingVolumeOutput(common.HexToAddress("0x1111111111111111111111111111111111111111"))
+
+	if _, _, err := hook.Build(nil, output[:len(output)-1]); err == nil {
+		t.Fatal("expected an error for a truncated output")
+	}
+
+	// An account word with dirty high bytes is not an address
+	dirty := bytes.Clone(output)
+	dirty[0] = 1
+	if _, _, err := hook.Build(nil, dirty); err == nil {
+		t.Fatal("expected an error for an output that is not ABI encoded")
+	}
+
+	// blockNum must fit the uint64 of the generated library
+	overflow := bytes.Clone(output)
+	overflow[32] = 1
+	if _, _, err := hook.Build(nil, overflow); err == nil {
+		t.Fatal("expected an error for an overflowing blockNum")
+	}
+}
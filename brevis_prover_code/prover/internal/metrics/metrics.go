@@ -0,0 +1,108 @@
+// Package metrics defines the Prometheus metrics of the prover. They are
+// registered with the default registry, which the configuration API serves at
+// /metrics.
+package metrics
+
+import (
+	"strings"
+
+	"github.com/brevis-network/brevis-sdk/sdk/proto/sdkproto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "prover"
+
+var (
+	// ProofsRequested counts proof requests by profile. Requests naming an
+	// unknown profile or chain have an empty profile.
+	ProofsRequested = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "proofs_requested_total",
+		Help:      "Proof requests by profile.",
+	}, []string{"profile"})
+	ProofsSucceeded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "proofs_succeeded_total",
+		Help:      "Proofs generated or taken from the cache by profile.",
+	}, []string{"profile"})
+	// ProofsFailed counts failed proof requests by profile and ErrorClass
+	ProofsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "proofs_failed_total",
+		Help:      "Failed proof requests by profile and error class.",
+	}, []string{"profile", "class"})
+	ProvingDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "proving_duration_seconds",
+		Help:      "Time spent generating a proof by profile.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"profile"})
+	ProofsInProgress = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "proofs_in_progress",
+		Help:      "Proofs being generated.",
+	})
+	JobsQueued = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "jobs_queued",
+		Help:      "Jobs waiting for a prover worker.",
+	})
+
+	CacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_hits_total",
+		Help:      "Proof requests answered from the proof cache.",
+	})
+	CacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_misses_total",
+		Help:      "Proof requests not found in the proof cache.",
+	})
+	CacheEntries = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cache_entries",
+		Help:      "Proofs in the proof cache.",
+	})
+	CacheBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cache_bytes",
+		Help:      "Size of the proofs in the proof cache.",
+	})
+
+	RPCRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_requests_total",
+		Help:      "JSON-RPC calls to the source chains by chain and method.",
+	}, []string{"chain", "method"})
+	RPCErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_errors_total",
+		Help:      "Failed JSON-RPC calls to the source chains by chain and method.",
+	}, []string{"chain", "method"})
+	RPCDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rpc_duration_seconds",
+		Help:      "Latency of JSON-RPC calls to the source chains by chain and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"chain", "method"})
+
+	// CircuitInfo is 1 for every served profile, labeled with its circuit's
+	// VK hash
+	CircuitInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "circuit_info",
+		Help:      "Served circuit profiles with their chain and VK hash.",
+	}, []string{"profile", "chain", "vk_hash"})
+	ProfileRevision = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "profile_revision",
+		Help:      "Revision of the served circuit profiles, raised by every change.",
+	})
+)
+
+// ErrorClass returns the class label of a failed proof request, e.g.
+// invalid_input for sdkproto.ErrCode_ERROR_INVALID_INPUT
+func ErrorClass(code sdkproto.ErrCode) string {
+	return strings.ToLower(strings.TrimPrefix(code.String(), "ERROR_"))
+}
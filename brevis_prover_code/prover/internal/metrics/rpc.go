@@ -0,0 +1,154 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+)
+
+// RPCProxy is a local JSON-RPC endpoint forwarding the calls to the RPC
+// endpoint of a source chain and measuring them. The SDK dials the chains with
+// the default HTTP client, so the prover points it at a proxy instead of the
+// chain to measure its calls.
+type RPCProxy struct {
+	proxy  *httputil.ReverseProxy
+	server *http.Server
+}
+
+// NewRPCProxy returns a proxy of the http(s) endpoint labeling the calls with
+// the chain. WebSocket endpoints cannot be proxied.
+func NewRPCProxy(endpoint, chain string) (*RPCProxy, error) {
+	target, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return nil, fmt.Errorf("cannot proxy %s endpoint", target.Scheme)
+	}
+	proxy := &httputil.ReverseProxy{
+		// Calls go to the endpoint as it is, whatever path they were sent to
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.Out.URL = &url.URL{Scheme: target.Scheme, User: target.User, Host: target.Host, Path: target.Path, RawQuery: target.RawQuery}
+			r.Out.Host = target.Host
+		},
+		Transport: &rpcTransport{next: http.DefaultTransport, chain: chain},
+	}
+	return &RPCProxy{proxy: proxy}, nil
+}
+
+// ServeHTTP forwards the call to the endpoint
+func (p *RPCProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Buffer the call so the transport can read its method before sending it
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	p.proxy.ServeHTTP(w, r)
+}
+
+// Start serves the proxy at a free local port and returns its URL
+func (p *RPCProxy) Start() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	p.server = &http.Server{Handler: p}
+	go func() {
+		if err := p.server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Println("RPC proxy crashed:", err.Error())
+		}
+	}()
+	return "http://" + l.Addr().String(), nil
+}
+
+// Close stops serving the proxy
+func (p *RPCProxy) Close() error {
+	if p.server == nil {
+		return nil
+	}
+	return p.server.Close()
+}
+
+// rpcTransport measures the JSON-RPC calls to the chain sent through it
+type rpcTransport struct {
+	next  http.RoundTripper
+	chain string
+}
+
+// RoundTrip sends the request and records its JSON-RPC method, latency and
+// whether it failed
+func (t *rpcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	method := rpcMethod(req)
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	failed := err != nil || resp.StatusCode >= http.StatusBadRequest
+	if !failed {
+		if failed, err = rpcFailed(resp); err != nil {
+			resp = nil
+		}
+	}
+	RPCDuration.WithLabelValues(t.chain, method).Observe(time.Since(start).Seconds())
+	RPCRequests.WithLabelValues(t.chain, method).Inc()
+	if failed {
+		RPCErrors.WithLabelValues(t.chain, method).Inc()
+	}
+	return resp, err
+}
+
+// rpcMethod returns the method of a JSON-RPC call, batch for batches of calls
+func rpcMethod(req *http.Request) string {
+	if req.GetBody == nil {
+		return "unknown"
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return "unknown"
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "unknown"
+	}
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+		return "batch"
+	}
+	var call struct {
+		Method string `json:"method"`
+	}
+	if json.Unmarshal(data, &call) != nil || call.Method == "" {
+		return "unknown"
+	}
+	return call.Method
+}
+
+// rpcFailed returns whether the response is a JSON-RPC error. The response
+// body is read and replaced, so the caller can still read it.
+func rpcFailed(resp *http.Response) (bool, error) {
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return true, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	var result struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(data, &result) != nil {
+		// batches are not inspected
+		return false, nil
+	}
+	return len(result.Error) > 0 && string(result.Error) != "null", nil
+}
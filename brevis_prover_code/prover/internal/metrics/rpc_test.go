@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"prover/internal/mockrpc"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRPCProxy(t *testing.T) {
+	s, err := mockrpc.LoadScenario("../../scenarios/usdc_usdt.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := mockrpc.New(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	if _, err = NewRPCProxy("wss://example.org", "1"); err == nil {
+		t.Error("expected a WebSocket endpoint to be rejected")
+	}
+	proxy, err := NewRPCProxy(srv.URL, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Close()
+	proxyURL, err := proxy.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := rpc.Dial(proxyURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+	ec := ethclient.NewClient(c)
+	if id, err := ec.ChainID(ctx); err != nil || id.Uint64() != 1 {
+		t.Fatalf("got chain %v, %v", id, err)
+	}
+	if _, err = ec.TransactionReceipt(ctx, common.Hash{1}); err == nil {
+		t.Fatal("expected an unknown receipt to be not found")
+	}
+	if err = c.CallContext(ctx, nil, "eth_gasPrice"); err == nil {
+		t.Fatal("expected an unsupported method to fail")
+	}
+
+	for _, tt := range []struct {
+		method           string
+		requests, errors float64
+	}{
+		{"eth_chainId", 1, 0},
+		{"eth_getTransactionReceipt", 1, 0},
+		{"eth_gasPrice", 1, 1},
+	} {
+		if got := testutil.ToFloat64(RPCRequests.WithLabelValues("1", tt.method)); got != tt.requests {
+			t.Errorf("%s: %v requests, want %v", tt.method, got, tt.requests)
+		}
+		if got := testutil.ToFloat64(RPCErrors.WithLabelValues("1", tt.method)); got != tt.errors {
+			t.Errorf("%s: %v errors, want %v", tt.method, got, tt.errors)
+		}
+	}
+	if n := testutil.CollectAndCount(RPCDuration); n != 3 {
+		t.Errorf("got latencies of %d methods, want 3", n)
+	}
+}
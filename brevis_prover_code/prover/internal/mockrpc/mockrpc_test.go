@@ -0,0 +1,138 @@
+package mockrpc
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+
+	"prover/circuits"
+	"prover/outputs"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+func serveScenario(t *testing.T) string {
+	s, err := LoadScenario("../../scenarios/usdc_usdt.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := New(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(server)
+	t.Cleanup(func() {
+		srv.Close()
+		server.Close()
+	})
+	return srv.URL
+}
+
+func TestServeScenario(t *testing.T) {
+	ec, err := ethclient.Dial(serveScenario(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if chainId, err := ec.ChainID(ctx); err != nil || chainId.Uint64() != 1 {
+		t.Fatalf("chain ID %v, %v", chainId, err)
+	}
+	if head, err := ec.BlockNumber(ctx); err != nil || head != 19000100 {
+		t.Fatalf("head %d, %v", head, err)
+	}
+
+	block, err := ec.BlockByNumber(ctx, big.NewInt(19000000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.BaseFee().Uint64() != 30000000000 || block.Time() != 1705000000 {
+		t.Errorf("unexpected block %+v", block.Header())
+	}
+	if _, err = ec.BlockByNumber(ctx, big.NewInt(1)); !errors.Is(err, ethereum.NotFound) {
+		t.Errorf("expected an unknown block to be not found, got %v", err)
+	}
+
+	receipt, err := ec.TransactionReceipt(ctx, common.BigToHash(big.NewInt(0xa1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.TransactionIndex != 12 || receipt.BlockNumber.Uint64() != 19000000 || receipt.BlockHash != block.Hash() || len(receipt.Logs) != 2 {
+		t.Errorf("unexpected receipt %+v", receipt)
+	}
+	if _, err = ec.TransactionReceipt(ctx, common.Hash{1}); !errors.Is(err, ethereum.NotFound) {
+		t.Errorf("expected an unknown receipt to be not found, got %v", err)
+	}
+
+	// Storage keeps its value in later blocks
+	usdc := common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+	slot := common.BigToHash(big.NewInt(9))
+	for block, want := range map[int64]int64{18999999: 0, 19000000: 10000e6, 19000100: 10000e6} {
+		value, err := ec.StorageAt(ctx, usdc, slot, big.NewInt(block))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := new(big.Int).SetBytes(value).Int64(); got != want {
+			t.Errorf("storage at block %d is %d, expected %d", block, got, want)
+		}
+	}
+}
+
+// TestBuildCircuitInput queries the receipts of a proof through the SDK
+func TestBuildCircuitInput(t *testing.T) {
+	app, err := sdk.NewBrevisApp(1, serveScenario(t), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	transfer := func(tx int64, logPos uint) sdk.ReceiptData {
+		return sdk.ReceiptData{
+			TxHash: common.BigToHash(big.NewInt(tx)),
+			Fields: []sdk.LogFieldData{
+				{LogPos: logPos, IsTopic: true, FieldIndex: 1},
+				{LogPos: logPos, IsTopic: false, FieldIndex: 0},
+			},
+		}
+	}
+	app.AddReceipt(transfer(0xa1, 1), 0)
+	app.AddReceipt(transfer(0xa2, 0), 1)
+
+	in, err := app.BuildCircuitInput(circuits.NewAppCircuit(circuits.DefaultParams()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := outputs.DecodeProfitTrackingOutput(in.GetAbiPackedOutput())
+	if err != nil {
+		t.Fatal(err)
+	}
+	profit, _ := new(big.Int).SetString("50000000000000000000", 10)
+	if !out.IsProfit || out.PnlAmount.Cmp(profit) != 0 || out.SellBlockNum != 19000100 {
+		t.Errorf("unexpected output %+v", out)
+	}
+}
+
+func TestInvalidScenario(t *testing.T) {
+	block := func(n uint64, txs ...int64) Block {
+		b := Block{Number: n, BaseFee: big.NewInt(1)}
+		for i, tx := range txs {
+			b.Receipts = append(b.Receipts, Receipt{TxHash: common.BigToHash(big.NewInt(tx)), TxIndex: uint(i)})
+		}
+		return b
+	}
+	cases := map[string]Scenario{
+		"no blocks":         {},
+		"duplicate block":   {Blocks: []Block{block(1), block(1)}},
+		"no base fee":       {Blocks: []Block{{Number: 1}}},
+		"duplicate receipt": {Blocks: []Block{block(1, 5), block(2, 5)}},
+		"no tx hash":        {Blocks: []Block{block(1, 0)}},
+	}
+	for name, s := range cases {
+		if _, err := New(&s); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// Package mockrpc serves the subset of the Ethereum JSON-RPC API the Brevis SDK
+// uses from a scenario file, so the prover can run without a live chain
+package mockrpc
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario describes the chain the mock serves. Scenario files are YAML, or
+// JSON with the same field names.
+//
+// Blocks carry no transaction bodies, so receipts can be served but
+// transaction proofs cannot be built from them.
+type Scenario struct {
+	ChainId uint64  `yaml:"chain_id"`
+	Blocks  []Block `yaml:"blocks"`
+}
+
+// Block is a block with the receipts and storage values queried from it
+type Block struct {
+	Number    uint64    `yaml:"number"`
+	BaseFee   *big.Int  `yaml:"base_fee"`
+	Timestamp uint64    `yaml:"timestamp"`
+	Receipts  []Receipt `yaml:"receipts"`
+	// Storage values set in this block. They keep their value in later blocks
+	// until set again.
+	Storage []StorageValue `yaml:"storage"`
+}
+
+// Receipt is a transaction receipt
+type Receipt struct {
+	TxHash  common.Hash `yaml:"tx_hash"`
+	TxIndex uint        `yaml:"tx_index"`
+	// Failed marks a reverted transaction
+	Failed bool  `yaml:"failed"`
+	Logs   []Log `yaml:"logs"`
+}
+
+// Log is an event emitted by a transaction
+type Log struct {
+	Address common.Address `yaml:"address"`
+	Topics  []common.Hash  `yaml:"topics"`
+	Data    hexutil.Bytes  `yaml:"data"`
+}
+
+// StorageValue is the value of a storage slot
+type StorageValue struct {
+	Address common.Address `yaml:"address"`
+	Slot    common.Hash    `yaml:"slot"`
+	Value   common.Hash    `yaml:"value"`
+}
+
+// LoadScenario reads and validates the scenario file at path
+func LoadScenario(path string) (*Scenario, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario: %s", err.Error())
+	}
+	// JSON is valid YAML, so both formats decode the same way
+	var s Scenario
+	if err = yaml.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario %s: %s", path, err.Error())
+	}
+	if err = s.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid scenario %s: %s", path, err.Error())
+	}
+	return &s, nil
+}
+
+// Validate checks that the scenario describes a consistent chain. A missing
+// chain ID defaults to 1.
+func (s *Scenario) Validate() error {
+	if s.ChainId == 0 {
+		s.ChainId = 1
+	}
+	if len(s.Blocks) == 0 {
+		return fmt.Errorf("no blocks")
+	}
+	blocks := make(map[uint64]bool)
+	txs := make(map[common.Hash]bool)
+	for _, b := range s.Blocks {
+		if blocks[b.Number] {
+			return fmt.Errorf("duplicate block %d", b.Number)
+		}
+		blocks[b.Number] = true
+		if b.BaseFee == nil || b.BaseFee.Sign() < 0 {
+			return fmt.Errorf("block %d has no base fee", b.Number)
+		}
+
+		indexes := make(map[uint]bool)
+		for _, r := range b.Receipts {
+			if r.TxHash == (common.Hash{}) {
+				return fmt.Errorf("block %d has a receipt without tx hash", b.Number)
+			}
+			if txs[r.TxHash] {
+				return fmt.Errorf("duplicate receipt %s", r.TxHash.Hex())
+			}
+			txs[r.TxHash] = true
+			if indexes[r.TxIndex] {
+				return fmt.Errorf("block %d has two receipts with tx index %d", b.Number, r.TxIndex)
+			}
+			indexes[r.TxIndex] = true
+			for i, l := range r.Logs {
+				if len(l.Topics) > 4 {
+					return fmt.Errorf("receipt %s log %d has %d topics", r.TxHash.Hex(), i, len(l.Topics))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// chain is a scenario turned into headers and receipts
+type chain struct {
+	chainId  uint64
+	headers  map[uint64]*types.Header
+	head     uint64
+	receipts map[common.Hash]*types.Receipt
+	// storage values by account and slot, ordered by block
+	storage map[common.Address]map[common.Hash][]blockValue
+}
+
+type blockValue struct {
+	block uint64
+	value common.Hash
+}
+
+func newChain(s *Scenario) *chain {
+	c := &chain{
+		chainId:  s.ChainId,
+		headers:  make(map[uint64]*types.Header),
+		receipts: make(map[common.Hash]*types.Receipt),
+		storage:  make(map[common.Address]map[common.Hash][]blockValue),
+	}
+
+	blocks := append([]Block(nil), s.Blocks...)
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Number < blocks[j].Number })
+
+	var parent common.Hash
+	for _, b := range blocks {
+		receipts := c.blockReceipts(b)
+		header := &types.Header{
+			ParentHash:  parent,
+			UncleHash:   types.EmptyUncleHash,
+			Root:        types.EmptyRootHash,
+			TxHash:      types.EmptyTxsHash,
+			ReceiptHash: types.EmptyReceiptsHash,
+			Bloom:       types.CreateBloom(receipts),
+			Difficulty:  new(big.Int),
+			Number:      new(big.Int).SetUint64(b.Number),
+			GasLimit:    30_000_000,
+			Time:        b.Timestamp,
+			BaseFee:     b.BaseFee,
+		}
+		hash := header.Hash()
+		for _, r := range receipts {
+			r.BlockHash = hash
+			for _, l := range r.Logs {
+				l.BlockHash = hash
+			}
+			c.receipts[r.TxHash] = r
+		}
+		c.headers[b.Number] = header
+		c.head = b.Number
+		parent = hash
+
+		for _, v := range b.Storage {
+			if c.storage[v.Address] == nil {
+				c.storage[v.Address] = make(map[common.Hash][]blockValue)
+			}
+			c.storage[v.Address][v.Slot] = append(c.storage[v.Address][v.Slot], blockValue{b.Number, v.Value})
+		}
+	}
+	return c
+}
+
+// blockReceipts returns the receipts of the block in transaction order, with
+// log indexes counted across the block like a node does
+func (c *chain) blockReceipts(b Block) types.Receipts {
+	sorted := append([]Receipt(nil), b.Receipts...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].TxIndex < sorted[j].TxIndex })
+
+	var receipts types.Receipts
+	var logIndex uint
+	for _, r := range sorted {
+		receipt := &types.Receipt{
+			Type:              types.LegacyTxType,
+			Status:            types.ReceiptStatusSuccessful,
+			TxHash:            r.TxHash,
+			EffectiveGasPrice: b.BaseFee,
+			BlockNumber:       new(big.Int).SetUint64(b.Number),
+			TransactionIndex:  r.TxIndex,
+			Logs:              []*types.Log{},
+		}
+		if r.Failed {
+			receipt.Status = types.ReceiptStatusFailed
+		}
+		for _, l := range r.Logs {
+			receipt.Logs = append(receipt.Logs, &types.Log{
+				Address:     l.Address,
+				Topics:      l.Topics,
+				Data:        l.Data,
+				BlockNumber: b.Number,
+				TxHash:      r.TxHash,
+				TxIndex:     r.TxIndex,
+				Index:       logIndex,
+			})
+			logIndex++
+		}
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		receipts = append(receipts, receipt)
+	}
+	return receipts
+}
+
+// storageAt returns the value of the slot at the given block
+func (c *chain) storageAt(account common.Address, slot common.Hash, block uint64) common.Hash {
+	var value common.Hash
+	for _, v := range c.storage[account][slot] {
+		if v.block > block {
+			break
+		}
+		value = v.value
+	}
+	return value
+}
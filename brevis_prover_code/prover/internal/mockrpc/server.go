@@ -0,0 +1,127 @@
+package mockrpc
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Server is an http.Handler serving a scenario over JSON-RPC. It implements
+// eth_chainId, eth_blockNumber, eth_getBlockByNumber,
+// eth_getTransactionReceipt and eth_getStorageAt.
+type Server struct {
+	rpc *rpc.Server
+}
+
+// New returns a server for the scenario
+func New(s *Scenario) (*Server, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", &ethAPI{chain: newChain(s)}); err != nil {
+		return nil, err
+	}
+	return &Server{rpc: server}, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.rpc.ServeHTTP(w, r)
+}
+
+// Close stops serving requests
+func (s *Server) Close() {
+	s.rpc.Stop()
+}
+
+// ethAPI implements the eth namespace. The chain is never modified after it
+// is built, so requests need no locking.
+type ethAPI struct {
+	chain *chain
+}
+
+func (api *ethAPI) ChainId() *hexutil.Big {
+	return (*hexutil.Big)(new(big.Int).SetUint64(api.chain.chainId))
+}
+
+func (api *ethAPI) BlockNumber() hexutil.Uint64 {
+	return hexutil.Uint64(api.chain.head)
+}
+
+// GetBlockByNumber returns the block header with empty transaction and uncle
+// lists, or nil if the scenario has no such block
+func (api *ethAPI) GetBlockByNumber(number rpc.BlockNumber, fullTx bool) (map[string]interface{}, error) {
+	header := api.chain.headers[api.blockNumber(number)]
+	if header == nil {
+		return nil, nil
+	}
+	fields, err := marshalFields(header)
+	if err != nil {
+		return nil, err
+	}
+	fields["transactions"] = []interface{}{}
+	fields["uncles"] = []common.Hash{}
+	fields["size"] = hexutil.Uint64(header.Size())
+	return fields, nil
+}
+
+// GetTransactionReceipt returns the receipt, or nil if the scenario has no
+// such transaction
+func (api *ethAPI) GetTransactionReceipt(hash common.Hash) *types.Receipt {
+	return api.chain.receipts[hash]
+}
+
+func (api *ethAPI) GetStorageAt(account common.Address, slot common.Hash, block rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	number := api.chain.head
+	if n, ok := block.Number(); ok {
+		number = api.blockNumber(n)
+	} else if hash, ok := block.Hash(); ok {
+		found := false
+		for n, h := range api.chain.headers {
+			if h.Hash() == hash {
+				number, found = n, true
+				break
+			}
+		}
+		if !found {
+			return nil, &unknownBlockError{}
+		}
+	}
+	value := api.chain.storageAt(account, slot, number)
+	return value[:], nil
+}
+
+// blockNumber resolves block tags such as latest to the head of the scenario
+func (api *ethAPI) blockNumber(n rpc.BlockNumber) uint64 {
+	if n < 0 {
+		return api.chain.head
+	}
+	return uint64(n)
+}
+
+// marshalFields returns the JSON fields of v, to be extended with more fields
+func marshalFields(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]json.RawMessage
+	if err = json.Unmarshal(b, &raw); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{}, len(raw))
+	for k, v := range raw {
+		fields[k] = v
+	}
+	return fields, nil
+}
+
+type unknownBlockError struct{}
+
+func (e *unknownBlockError) Error() string  { return "unknown block" }
+func (e *unknownBlockError) ErrorCode() int { return -32000 }
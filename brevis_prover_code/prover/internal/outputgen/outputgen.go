@@ -0,0 +1,234 @@
+// Package outputgen generates Solidity and Go decoders for the packed output of
+// the circuits, from their output schemas
+package outputgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"prover/circuits"
+)
+
+// field is an output field together with its position in the packed output
+type field struct {
+	circuits.OutputField
+	Offset int
+}
+
+func (f field) End() int {
+	return f.Offset + f.Size
+}
+
+// Word returns whether the field is a 32 byte word decoded as a smaller type
+func (f field) Word() bool {
+	return f.Size == 32 && f.Type != "bytes32" && f.Type != "uint256"
+}
+
+// GoName is the exported Go name of the field
+func (f field) GoName() string {
+	return strings.ToUpper(f.Name[:1]) + f.Name[1:]
+}
+
+// GoType is the Go type the field decodes to
+func (f field) GoType() string {
+	switch {
+	case f.Type == "address":
+		return "common.Address"
+	case f.Type == "bool":
+		return "bool"
+	case f.Type == "bytes32":
+		return "common.Hash"
+	case f.bits() <= 8:
+		return "uint8"
+	case f.bits() <= 32:
+		return "uint32"
+	case f.bits() <= 64:
+		return "uint64"
+	}
+	return "*big.Int"
+}
+
+// GoDecode is the Go expression decoding the field from b
+func (f field) GoDecode() string {
+	raw := fmt.Sprintf("b[%d:%d]", f.Offset, f.End())
+	switch t := f.GoType(); t {
+	case "common.Address":
+		return fmt.Sprintf("common.BytesToAddress(%s)", raw)
+	case "bool":
+		return fmt.Sprintf("new(big.Int).SetBytes(%s).Sign() != 0", raw)
+	case "common.Hash":
+		return fmt.Sprintf("common.BytesToHash(%s)", raw)
+	case "*big.Int":
+		return fmt.Sprintf("new(big.Int).SetBytes(%s)", raw)
+	case "uint64":
+		return fmt.Sprintf("new(big.Int).SetBytes(%s).Uint64()", raw)
+	default:
+		return fmt.Sprintf("%s(new(big.Int).SetBytes(%s).Uint64())", t, raw)
+	}
+}
+
+// SolDecode is the Solidity expression decoding the field from o. Fields are
+// read as the 32 bytes starting at their offset, so o can be in memory.
+func (f field) SolDecode() string {
+	raw := fmt.Sprintf("word(o, %d)", f.Offset)
+	if f.Word() {
+		word := fmt.Sprintf("uint256(%s)", raw)
+		switch f.Type {
+		case "address":
+			return fmt.Sprintf("address(uint160(%s))", word)
+		case "bool":
+			return fmt.Sprintf("%s != 0", word)
+		}
+		return fmt.Sprintf("%s(%s)", f.Type, word)
+	}
+	switch f.Type {
+	case "address":
+		return fmt.Sprintf("address(bytes20(%s))", raw)
+	case "bool":
+		return fmt.Sprintf("uint8(o[%d]) != 0", f.Offset)
+	case "bytes32":
+		return raw
+	}
+	return fmt.Sprintf("%s(bytes%d(%s))", f.Type, f.Size, raw)
+}
+
+func (f field) bits() int {
+	bits, _ := strconv.Atoi(strings.TrimPrefix(f.Type, "uint"))
+	return bits
+}
+
+type schema struct {
+	circuits.OutputSchema
+	Fields []field
+	Size   int
+}
+
+func newSchema(s circuits.OutputSchema) (schema, error) {
+	out := schema{OutputSchema: s, Size: s.Size()}
+	names := make(map[string]bool)
+	offset := 0
+	for _, f := range s.Fields {
+		if f.Name == "" || names[f.Name] {
+			return schema{}, fmt.Errorf("%s: empty or duplicate output field name %q", s.Name, f.Name)
+		}
+		names[f.Name] = true
+		if f.Size < 1 || f.Size > 32 {
+			return schema{}, fmt.Errorf("%s: output field %s has invalid size %d", s.Name, f.Name, f.Size)
+		}
+		out.Fields = append(out.Fields, field{OutputField: f, Offset: offset})
+		offset += f.Size
+	}
+	return out, nil
+}
+
+var solidityTemplate = template.Must(template.New("sol").Parse(`// SPDX-License-Identifier: MIT
+// Code generated by outputgen from the {{.Name}} circuit output schema. DO NOT EDIT.
+pragma solidity ^0.8.20;
+
+library {{.Name}}Output {
+    uint256 internal constant SIZE = {{.Size}};
+
+    struct Output {
+{{- range .Fields}}
+        {{.Type}} {{.Name}};
+{{- end}}
+    }
+
+    function decodeOutput(bytes memory o) internal pure returns (Output memory out) {
+        require(o.length == SIZE, "{{.Name}}Output: invalid circuit output length");
+{{- range .Fields}}
+        out.{{.Name}} = {{.SolDecode}};
+{{- end}}
+    }
+
+    // word returns the 32 bytes of o at offset, which may extend past its end
+    function word(bytes memory o, uint256 offset) private pure returns (bytes32 w) {
+        assembly {
+            w := mload(add(add(o, 32), offset))
+        }
+    }
+}
+`))
+
+var goTemplate = template.Must(template.New("go").Parse(`// Code generated by outputgen from the {{.Name}} circuit output schema. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// {{.Name}}Size is the length of the packed {{.Name}} circuit output
+const {{.Name}}Size = {{.Size}}
+
+// {{.Name}}Output is the decoded {{.Name}} circuit output
+type {{.Name}}Output struct {
+{{- range .Fields}}
+	{{.GoName}} {{.GoType}}
+{{- end}}
+}
+
+// Decode{{.Name}}Output decodes the packed {{.Name}} circuit output
+func Decode{{.Name}}Output(b []byte) (*{{.Name}}Output, error) {
+	if len(b) != {{.Name}}Size {
+		return nil, fmt.Errorf("invalid {{.Name}} output length %d, expected %d", len(b), {{.Name}}Size)
+	}
+	return &{{.Name}}Output{
+{{- range .Fields}}
+		{{.GoName}}: {{.GoDecode}},
+{{- end}}
+	}, nil
+}
+`))
+
+// Solidity returns a Solidity library named <Name>Output declaring the
+// circuit output as a struct and decoding it with decodeOutput(bytes)
+func Solidity(s circuits.OutputSchema) ([]byte, error) {
+	sch, err := newSchema(s)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err = solidityTemplate.Execute(&buf, sch); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Go returns a Go file in package pkg declaring the circuit output as a struct
+// and decoding it with Decode<Name>Output
+func Go(s circuits.OutputSchema, pkg string) ([]byte, error) {
+	sch, err := newSchema(s)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = goTemplate.Execute(&buf, struct {
+		schema
+		Package string
+	}{sch, pkg})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+// GoFileName returns the name of the Go file generated for the schema, e.g.
+// profit_tracking.go for ProfitTracking
+func GoFileName(s circuits.OutputSchema) string {
+	var name strings.Builder
+	for i, r := range s.Name {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			name.WriteByte('_')
+		}
+		name.WriteRune(r)
+	}
+	return strings.ToLower(name.String()) + ".go"
+}
@@ -0,0 +1,53 @@
+package outputgen
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"prover/circuits"
+)
+
+// TestGeneratedFilesUpToDate fails if a circuit output changed without
+// regenerating the decoders with go run ./cmd/outputgen
+func TestGeneratedFilesUpToDate(t *testing.T) {
+	for _, c := range circuits.OutputCircuits() {
+		schema := c.OutputSchema()
+
+		sol, err := Solidity(schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkFile(t, filepath.Join("../../../../src/lib/circuits", schema.Name+"Output.sol"), sol)
+
+		src, err := Go(schema, "outputs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkFile(t, filepath.Join("../../outputs", GoFileName(schema)), src)
+	}
+}
+
+func checkFile(t *testing.T, path string, want []byte) {
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("failed to read generated file: %s", err.Error())
+		return
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s is out of date, run go run ./cmd/outputgen", path)
+	}
+}
+
+func TestInvalidSchema(t *testing.T) {
+	for _, schema := range []circuits.OutputSchema{
+		{Name: "Duplicate", Fields: []circuits.OutputField{{Name: "a", Type: "bool", Size: 1}, {Name: "a", Type: "bool", Size: 1}}},
+		{Name: "Unnamed", Fields: []circuits.OutputField{{Type: "bool", Size: 1}}},
+		{Name: "TooLarge", Fields: []circuits.OutputField{{Name: "a", Type: "uint264", Size: 33}}},
+	} {
+		if _, err := Solidity(schema); err == nil {
+			t.Errorf("expected error for schema %s", schema.Name)
+		}
+	}
+}
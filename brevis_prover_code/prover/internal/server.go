@@ -1,84 +1,400 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"prover/circuits"
+	"prover/internal/auth"
+	"prover/internal/hookdata"
+	"prover/internal/service"
+	"prover/tokens"
 
-	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/brevis-network/brevis-sdk/sdk/proto/sdkproto"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/protobuf/encoding/protojson"
 )
 
-// Circuit is a global variable so we can update its parameters
-var (
-	Circuit    = &circuits.AppCircuit{}
-	Token1Addr = sdk.ConstUint248("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48") // Default: USDC
-	Token2Addr = sdk.ConstUint248("0xdAC17F958D2ee523a2206206994597C13D831ec7") // Default: USDT
-	MinVolume  = sdk.ConstUint248(500000000)                                    // Default: 500 tokens
-)
+// API serves the circuit configuration of a running prover service
+type API struct {
+	Prover *service.Service
+	// Auth authenticates the callers, nil to accept every request. Audit
+	// records the configuration changes, nil to record none.
+	Auth  *auth.Authenticator
+	Audit *auth.AuditLog
+	// Tokens provides the symbols of the profiles' tokens and resolves the
+	// pairs of updates, nil to know no tokens
+	Tokens *tokens.Registry
+}
 
-// UpdateCircuitHandler handles updating circuit parameters
-func UpdateCircuitHandler(w http.ResponseWriter, r *http.Request) {
+// UpdateCircuitHandler handles updating circuit parameters. An update creates
+// a new version of the named profile and responds with its VK hash. Earlier
+// versions keep being served for proofs that reference them. Invalid fields
+// are reported in the fields of the error response. A dry run responds with
+// the profile the update would create and the parameters it changes.
+//
+// With an If-Match header holding the ETag of a configuration response, the
+// update is only applied if the profiles have not changed since, and rejected
+// with 412 Precondition Failed otherwise. Without one it is merged onto the
+// current profiles and rejected the same way if they change before it is
+// applied.
+func (a *API) UpdateCircuitHandler(w http.ResponseWriter, r *http.Request) {
 	var params CircuitParams
 
-	err := json.NewDecoder(r.Body).Decode(&params)
+	revision, err := ifMatch(r)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	snapshot := a.Prover.Snapshot()
+	if revision != service.AnyRevision && revision != snapshot.Revision {
+		w.Header().Set("ETag", etag(snapshot.Revision))
+		respondWithError(w, http.StatusPreconditionFailed, "The circuit profiles changed since revision "+strconv.FormatUint(revision, 10))
 		return
 	}
 
-	// Update token addresses
-	if params.Token1Address != "" {
-		Token1Addr = sdk.ConstUint248(params.Token1Address)
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload: "+err.Error())
+		return
 	}
 
-	if params.Token2Address != "" {
-		Token2Addr = sdk.ConstUint248(params.Token2Address)
+	// Start from the latest version of the profile, or the default profile
+	// when creating a new one
+	base, _ := snapshot.Profile(snapshot.Default)
+	if params.Profile == "" {
+		params.Profile = base.Name
+	}
+	var old interface{}
+	version := 1
+	if latest, ok := snapshot.Latest(params.Profile); ok {
+		base = latest
+		old = newProfileConfig(latest)
+		version = latest.Version + 1
+	}
+	newProfile, fields := params.apply(r.Context(), base.Profile, a.Tokens)
+	if len(fields) > 0 {
+		RespondWithJSON(w, http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Invalid circuit parameters",
+			Fields:  fields,
+		})
+		return
+	}
+	newProfile.Version = version
+	if err = a.Prover.ValidateProfile(newProfile); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	// Update minimum volume if provided
-	if params.MinimumVolume != "" {
-		volume, err := strconv.ParseUint(params.MinimumVolume, 10, 64)
-		if err != nil {
-			respondWithError(w, http.StatusBadRequest, "Invalid minimum volume")
-			return
+	if params.DryRun {
+		profile := ProfileConfig{
+			ID:      newProfile.ID(),
+			Name:    newProfile.Name,
+			Version: newProfile.Version,
+			Default: params.MakeDefault,
+			Config:  newCircuitParams(newProfile),
 		}
-		MinVolume = sdk.ConstUint248(volume)
+		a.describeTokens(r.Context(), &profile, newProfile)
+		w.Header().Set("ETag", etag(snapshot.Revision))
+		RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"dry_run": true,
+			"base":    base.ID,
+			"profile": profile,
+			"changes": changes(newCircuitParams(base.Profile), newCircuitParams(newProfile)),
+		})
+		return
 	}
 
-	// Return current circuit configuration
-	currentConfig := CircuitParams{
-		Token1Address: fmt.Sprintf("%v", Token1Addr),
-		Token2Address: fmt.Sprintf("%v", Token2Addr),
-		MinimumVolume: fmt.Sprintf("%v", MinVolume),
+	// The update was merged onto the snapshot, so it only applies to its
+	// revision even without If-Match
+	info, err := a.Prover.AddProfile(newProfile, params.MakeDefault, snapshot.Revision)
+	if errors.Is(err, service.ErrRevisionMismatch) {
+		w.Header().Set("ETag", etag(a.Prover.Snapshot().Revision))
+		respondWithError(w, http.StatusPreconditionFailed, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	err = a.Audit.Record(auth.AuditEntry{
+		Caller:     auth.Caller(r.Context()),
+		RemoteAddr: r.RemoteAddr,
+		Action:     "update_profile",
+		Target:     params.Profile,
+		Old:        old,
+		New:        newProfileConfig(info),
+	})
+	if err != nil {
+		fmt.Printf("failed to audit the creation of profile %s: %s\n", info.ID, err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Circuit profile "+info.ID+" created but not audited: "+err.Error())
+		return
 	}
 
+	w.Header().Set("ETag", etag(info.Revision))
 	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
-		"message": "Circuit parameters updated successfully",
-		"config":  currentConfig,
+		"message": "Circuit profile " + info.ID + " created successfully",
+		"profile": a.profileConfig(r.Context(), info),
 	})
 }
 
-// GetCircuitConfigHandler returns the current circuit configuration
-func GetCircuitConfigHandler(w http.ResponseWriter, r *http.Request) {
-	currentConfig := CircuitParams{
-		Token1Address: fmt.Sprintf("%v", Token1Addr),
-		Token2Address: fmt.Sprintf("%v", Token2Addr),
-		MinimumVolume: fmt.Sprintf("%v", MinVolume),
+// GetCircuitConfigHandler returns the configuration of all served profiles
+// and the source chains they are served for, as of one revision. The ETag
+// header holds the revision, for conditional updates.
+func (a *API) GetCircuitConfigHandler(w http.ResponseWriter, r *http.Request) {
+	snapshot := a.Prover.Snapshot()
+	w.Header().Set("ETag", etag(snapshot.Revision))
+	if r.Header.Get("If-None-Match") == etag(snapshot.Revision) {
+		w.WriteHeader(http.StatusNotModified)
+		return
 	}
+	profiles := []ProfileConfig{}
+	for _, info := range snapshot.Profiles {
+		profiles = append(profiles, a.profileConfig(r.Context(), info))
+	}
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"revision": snapshot.Revision,
+		"default":  snapshot.Default,
+		"chains":   a.Prover.Chains(),
+		"profiles": profiles,
+	})
+}
 
+// GetProfileConfigHandler returns the configuration of a single profile
+func (a *API) GetProfileConfigHandler(w http.ResponseWriter, r *http.Request) {
+	info, err := a.Prover.Profile(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	w.Header().Set("ETag", etag(info.Revision))
 	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
-		"config":  currentConfig,
+		"profile": a.profileConfig(r.Context(), info),
 	})
 }
 
+// HookDataHandler builds the hookData a hook verifies a proof from, out of the
+// proof and the circuit output
+func (a *API) HookDataHandler(w http.ResponseWriter, r *http.Request) {
+	var req HookDataRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	hook, ok := hookdata.Hooks[req.Hook]
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Unknown hook "+req.Hook+", expected one of "+strings.Join(hookdata.HookNames(), ", "))
+		return
+	}
+	proof, err := hexutil.Decode(req.Proof)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid proof: "+err.Error())
+		return
+	}
+	output, err := hexutil.Decode(req.Output)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid output: "+err.Error())
+		return
+	}
+
+	hookData, fields, err := hook.Build(proof, output)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success":       true,
+		"hook_data":     hexutil.Encode(hookData),
+		"public_inputs": hexutil.Encode(output),
+		"fields":        fields,
+	})
+}
+
+// SubmitJobHandler queues a proof request, in the JSON format of the prover
+// REST API, as a job. The X-Profile-Id header names the profile proving it.
+// The job can be polled with GetJobHandler.
+func (a *API) SubmitJobHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	var req sdkproto.ProveRequest
+	if err = protojson.Unmarshal(body, &req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid prove request: "+err.Error())
+		return
+	}
+
+	job, protoErr := a.Prover.SubmitJob(r.Header.Get("X-Profile-Id"), &req)
+	if protoErr != nil {
+		respondWithError(w, jobErrorStatus(protoErr.Code), protoErr.Msg)
+		return
+	}
+	RespondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"success": true,
+		"job":     job,
+	})
+}
+
+// GetJobHandler returns the status of a job, with its proof once it is done
+func (a *API) GetJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := a.Prover.Job(mux.Vars(r)["id"])
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Unknown job "+mux.Vars(r)["id"])
+		return
+	}
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"job":     job,
+	})
+}
+
+// GetCacheStatsHandler returns the number and size of the cached proofs and
+// the cache hit rate
+func (a *API) GetCacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"cache":   a.Prover.CacheStats(),
+	})
+}
+
+// EvictCacheHandler deletes cached proofs. The vk_hash query parameter limits
+// the eviction to the proofs of one circuit, older_than, e.g. 24h, to proofs
+// cached longer ago.
+func (a *API) EvictCacheHandler(w http.ResponseWriter, r *http.Request) {
+	var maxAge time.Duration
+	if v := r.URL.Query().Get("older_than"); v != "" {
+		var err error
+		if maxAge, err = time.ParseDuration(v); err != nil || maxAge < 0 {
+			respondWithError(w, http.StatusBadRequest, "Invalid older_than duration "+v)
+			return
+		}
+	}
+	evicted, err := a.Prover.EvictProofs(r.URL.Query().Get("vk_hash"), maxAge)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"evicted": evicted,
+		"cache":   a.Prover.CacheStats(),
+	})
+}
+
+// etag returns the ETag of a revision of the profiles
+func etag(revision uint64) string {
+	return `"` + strconv.FormatUint(revision, 10) + `"`
+}
+
+// ifMatch returns the revision in the If-Match header, AnyRevision if there
+// is none or it matches any
+func ifMatch(r *http.Request) (uint64, error) {
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	if v == "" || v == "*" {
+		return service.AnyRevision, nil
+	}
+	unquoted, err := strconv.Unquote(v)
+	if err != nil {
+		return 0, errors.New("Invalid If-Match header " + v + ", expected the ETag of a configuration response")
+	}
+	revision, err := strconv.ParseUint(unquoted, 10, 64)
+	if err != nil || revision == service.AnyRevision {
+		return 0, errors.New("Invalid If-Match header " + v + ", expected the ETag of a configuration response")
+	}
+	return revision, nil
+}
+
+// jobErrorStatus returns the HTTP status of a rejected job
+func jobErrorStatus(code sdkproto.ErrCode) int {
+	switch code {
+	case sdkproto.ErrCode_ERROR_INVALID_INPUT, sdkproto.ErrCode_ERROR_INVALID_CUSTOM_INPUT:
+		return http.StatusBadRequest
+	case sdkproto.ErrCode_ERROR_FAILED_TO_PROVE:
+		// the request data does not satisfy the circuit
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func newProfileConfig(info service.ProfileInfo) ProfileConfig {
+	return ProfileConfig{
+		ID:      info.ID,
+		Name:    info.Name,
+		Version: info.Version,
+		Default: info.Default,
+		VkHash:  info.VkHash,
+
+		ChainDefault: info.ChainDefault,
+		Config:       newCircuitParams(info.Profile),
+	}
+}
+
+// profileConfig returns the configuration of the profile with its tokens
+// described
+func (a *API) profileConfig(ctx context.Context, info service.ProfileInfo) ProfileConfig {
+	config := newProfileConfig(info)
+	a.describeTokens(ctx, &config, info.Profile)
+	return config
+}
+
+// describeTokens adds the profile's tokens and minimum volume to its
+// configuration. Tokens the registry does not know are shown without symbol.
+func (a *API) describeTokens(ctx context.Context, config *ProfileConfig, p circuits.Profile) {
+	describe := func(addr common.Address, decimals uint8) *TokenInfo {
+		info := &TokenInfo{Address: addr.Hex(), Decimals: decimals}
+		if token, err := a.Tokens.Token(ctx, p.ChainId, addr); err == nil {
+			info.Symbol = token.Symbol
+		}
+		return info
+	}
+	config.Token1 = describe(p.Params.Token1Addr, p.Params.Token1Decimals)
+	config.Token2 = describe(p.Params.Token2Addr, p.Params.Token2Decimals)
+	config.MinimumVolume = &Amount{
+		Raw:     p.Params.MinVolume.String(),
+		Decimal: tokens.FormatUnits(p.Params.MinVolume, p.Params.Token1Decimals),
+		Symbol:  config.Token1.Symbol,
+	}
+}
+
+func newCircuitParams(p circuits.Profile) CircuitParams {
+	params := CircuitParams{
+		Profile:       p.Name,
+		Kind:          p.Kind,
+		ChainId:       p.ChainId,
+		Token1Address: p.Params.Token1Addr.Hex(),
+		Token2Address: p.Params.Token2Addr.Hex(),
+		MinimumVolume: p.Params.MinVolume.String(),
+
+		Token1Decimals: &p.Params.Token1Decimals,
+		Token2Decimals: &p.Params.Token2Decimals,
+	}
+	if p.Params.UsesPrice() {
+		params.PoolManager = p.Params.PoolManager.Hex()
+		params.PoolId = p.Params.PoolId.Hex()
+	}
+	return params
+}
+
 // Helper function to respond with an error
 func respondWithError(w http.ResponseWriter, code int, message string) {
 	RespondWithJSON(w, code, Response{
@@ -87,19 +403,44 @@ func respondWithError(w http.ResponseWriter, code int, message string) {
 	})
 }
 
-func main() {
+// require passes requests from callers with the role on to the handler
+func (a *API) require(role auth.Role, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r, status, err := a.Auth.Authenticate(r, role)
+		if err != nil {
+			respondWithError(w, status, err.Error())
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// NewRouter returns the router serving the circuit configuration, hookData,
+// job and proof cache API, and the Prometheus metrics. Changing the
+// configuration and evicting proofs requires the admin role, everything else
+// the read role.
+func NewRouter(api *API) *mux.Router {
 	r := mux.NewRouter()
 
 	// API routes
-	r.HandleFunc("/api/config", GetCircuitConfigHandler).Methods("GET")
-	r.HandleFunc("/api/config", UpdateCircuitHandler).Methods("POST")
+	r.HandleFunc("/api/config", api.require(auth.RoleRead, api.GetCircuitConfigHandler)).Methods("GET")
+	r.HandleFunc("/api/config", api.require(auth.RoleAdmin, api.UpdateCircuitHandler)).Methods("POST")
+	r.HandleFunc("/api/config/{id}", api.require(auth.RoleRead, api.GetProfileConfigHandler)).Methods("GET")
+	r.HandleFunc("/api/hookdata", api.require(auth.RoleRead, api.HookDataHandler)).Methods("POST")
+	r.HandleFunc("/jobs", api.require(auth.RoleRead, api.SubmitJobHandler)).Methods("POST")
+	r.HandleFunc("/jobs/{id}", api.require(auth.RoleRead, api.GetJobHandler)).Methods("GET")
+	r.HandleFunc("/api/cache", api.require(auth.RoleRead, api.GetCacheStatsHandler)).Methods("GET")
+	r.HandleFunc("/api/cache", api.require(auth.RoleAdmin, api.EvictCacheHandler)).Methods("DELETE")
+	r.HandleFunc("/metrics", api.require(auth.RoleRead, promhttp.Handler().ServeHTTP)).Methods("GET")
 
-	// Get port from environment or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
+	return r
+}
 
-	log.Printf("Server starting on port %s...\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, r))
+// NewServer returns an HTTP server for the configuration API listening on addr
+func NewServer(addr string, api *API) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           NewRouter(api),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
 }
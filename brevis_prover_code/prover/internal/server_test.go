@@ -0,0 +1,32 @@
+package internal
+
+import (
+	"context"
+	"testing"
+
+	"prover/circuits"
+	"prover/tokens"
+)
+
+func TestDescribeTokens(t *testing.T) {
+	registry, err := tokens.Load("../configs/tokens.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := circuits.DefaultProfile()
+
+	var config ProfileConfig
+	(&API{Tokens: registry}).describeTokens(context.Background(), &config, p)
+	if config.Token1.Symbol != "USDC" || config.Token1.Address != usdc || config.Token2.Symbol != "USDT" || config.Token2.Decimals != 6 {
+		t.Errorf("unexpected tokens %+v, %+v", config.Token1, config.Token2)
+	}
+	if *config.MinimumVolume != (Amount{Raw: "500000000", Decimal: "500", Symbol: "USDC"}) {
+		t.Errorf("unexpected minimum volume %+v", config.MinimumVolume)
+	}
+
+	// Without a registry the tokens have no symbol
+	(&API{}).describeTokens(context.Background(), &config, p)
+	if config.Token1.Symbol != "" || config.MinimumVolume.Decimal != "500" {
+		t.Errorf("unexpected tokens %+v, %+v", config.Token1, config.MinimumVolume)
+	}
+}
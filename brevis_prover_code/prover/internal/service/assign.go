@@ -0,0 +1,169 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/brevis-network/brevis-sdk/sdk/proto/sdkproto"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// assignCustomInput returns a copy of app with the custom input fields from the
+// request assigned. Unlike the SDK's prover, the copy starts from app itself so
+// that custom inputs missing from the request keep their default values.
+func assignCustomInput(app sdk.AppCircuit, input *sdkproto.CustomInput) (sdk.AppCircuit, error) {
+	makeErr := func(msg string, err ...error) (sdk.AppCircuit, error) {
+		format := "cannot assign custom input: %s"
+		if len(err) == 1 {
+			return nil, fmt.Errorf(format+": %v", msg, err[0])
+		}
+		return nil, fmt.Errorf(format, msg)
+	}
+
+	// Support empty customInput
+	jsonBytes := "{}"
+	if input != nil && len(input.JsonBytes) > 0 {
+		jsonBytes = input.JsonBytes
+	}
+
+	// every custom input must be either at the top level or in a list that's at the top level of the struct
+	var customInput map[string]interface{}
+	err := json.Unmarshal([]byte(jsonBytes), &customInput)
+	if err != nil {
+		return makeErr("error reading custom input json", err)
+	}
+
+	vv := reflect.ValueOf(app)
+
+	// deref until we get the actual value
+	for vv.Kind() == reflect.Pointer {
+		vv = vv.Elem()
+	}
+
+	if vv.Kind() != reflect.Struct {
+		return makeErr("the concrete type of AppCircuit must be struct")
+	}
+
+	appStructRef := reflect.New(vv.Type())
+	appStruct := appStructRef.Elem()
+	appStruct.Set(vv)
+	structName := appStruct.Type().Name()
+
+	for k, raw := range customInput {
+		if len(k) == 0 {
+			return makeErr("received custom input with empty field name")
+		}
+		// capitalize the object key because all fields in an AppCircuit are exported
+		k = strings.ToUpper(k[:1]) + k[1:]
+
+		field := appStruct.FieldByName(k)
+		if field == (reflect.Value{}) || !isCircuitVariable(field) {
+			return makeErr(fmt.Sprintf("received custom input field that does not exist in %s: %s", structName, k))
+		}
+
+		if field.Kind() == reflect.Array || field.Kind() == reflect.Slice {
+			values, ok := raw.([]interface{})
+			if !ok {
+				return makeErr(fmt.Sprintf("type mismatch: field %s is defined as list in %s but in decoded json it is %v", k, structName, raw))
+			}
+			if field.Kind() == reflect.Slice {
+				field.Set(reflect.MakeSlice(field.Type(), len(values), len(values)))
+			}
+			if len(values) > field.Len() {
+				return makeErr(fmt.Sprintf("field %s of %s holds at most %d items, got %d", k, structName, field.Len(), len(values)))
+			}
+			for i, value := range values {
+				err = assignCircuitValue(field.Index(i), value)
+				if err != nil {
+					return makeErr(fmt.Sprintf("failed to assign %d-th item of field %s", i, k), err)
+				}
+			}
+		} else {
+			err = assignCircuitValue(field, raw)
+			if err != nil {
+				return makeErr(fmt.Sprintf("failed to assign field %s", k), err)
+			}
+		}
+	}
+
+	return appStructRef.Interface().(sdk.AppCircuit), nil
+}
+
+func isCircuitVariable(field reflect.Value) bool {
+	t := field.Type()
+	if t.Kind() == reflect.Array || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t.Implements(reflect.TypeOf((*sdk.CircuitVariable)(nil)).Elem())
+}
+
+// assignCircuitValue parses a json object of the form {"type": ..., "data": ...}
+// into the circuit variable type of field and sets it
+func assignCircuitValue(field reflect.Value, raw interface{}) (err error) {
+	// the sdk constructors panic on malformed values
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid value %v: %v", raw, r)
+		}
+	}()
+
+	val, ok := raw.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("failed to parse value %v", raw)
+	}
+	data, ok := val["data"]
+	if !ok {
+		return fmt.Errorf("missing data in value %v", raw)
+	}
+	typ, ok := val["type"].(string)
+	if !ok {
+		return fmt.Errorf("missing type in value %v", raw)
+	}
+	if typ != field.Type().Name() {
+		return fmt.Errorf("mismatch types: json has %s but field is %s", typ, field.Type().Name())
+	}
+
+	var v interface{}
+	switch typ {
+	case sdk.Uint248Type:
+		v = sdk.ConstUint248(jsonNumber(data))
+	case sdk.Uint521Type:
+		v = sdk.ConstUint521(jsonNumber(data))
+	case sdk.Uint32Type:
+		v = sdk.ConstUint32(jsonNumber(data))
+	case sdk.Uint64Type:
+		v = sdk.ConstUint64(jsonNumber(data))
+	case sdk.Int248Type:
+		b, ok := new(big.Int).SetString(fmt.Sprint(jsonNumber(data)), 10)
+		if !ok {
+			return fmt.Errorf("invalid Int248 encoding %v", data)
+		}
+		v = sdk.ConstInt248(b)
+	case sdk.Bytes32Type:
+		s, ok := data.(string)
+		if !ok {
+			return fmt.Errorf("invalid Bytes32 encoding %v", data)
+		}
+		v = sdk.ConstFromBigEndianBytes(common.FromHex(s))
+	default:
+		return fmt.Errorf("unsupported circuit value type %s", typ)
+	}
+
+	field.Set(reflect.ValueOf(v))
+	return nil
+}
+
+// jsonNumber turns a decoded json number into something the sdk constructors
+// accept. encoding/json decodes numbers as float64, which loses precision for
+// large values, so those should be sent as strings.
+func jsonNumber(data interface{}) interface{} {
+	if f, ok := data.(float64); ok {
+		i, _ := big.NewFloat(f).Int(nil)
+		return i.String()
+	}
+	return data
+}
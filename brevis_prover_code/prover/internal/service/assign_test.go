@@ -0,0 +1,48 @@
+package service
+
+import (
+	"testing"
+
+	"prover/circuits"
+
+	"github.com/brevis-network/brevis-sdk/sdk/proto/sdkproto"
+)
+
+func TestAssignCustomInputKeepsDefaults(t *testing.T) {
+	app := circuits.NewAppCircuit(circuits.DefaultParams())
+
+	guest, err := assignCustomInput(app, &sdkproto.CustomInput{
+		JsonBytes: `{"minVolume": {"type": "Uint248", "data": "1000"}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := guest.(*circuits.AppCircuit)
+	if got == app {
+		t.Fatal("expected a copy of the circuit")
+	}
+	if got.Token1Addr.String() != app.Token1Addr.String() || got.Token2Addr.String() != app.Token2Addr.String() {
+		t.Errorf("defaults not carried over: got %+v, want %+v", got, app)
+	}
+	if got.MinVolume.String() != "1000" {
+		t.Errorf("got min volume %s, want 1000", got.MinVolume)
+	}
+	if app.MinVolume.String() != circuits.DefaultParams().MinVolume.String() {
+		t.Errorf("defaults were modified: %s", app.MinVolume)
+	}
+}
+
+func TestAssignCustomInputRejectsUnknownFields(t *testing.T) {
+	app := circuits.NewAppCircuit(circuits.DefaultParams())
+
+	for _, input := range []string{
+		`{"foo": {"type": "Uint248", "data": "1"}}`,
+		`{"token1Addr": {"type": "Bytes32", "data": "0x01"}}`,
+		`not json`,
+	} {
+		_, err := assignCustomInput(app, &sdkproto.CustomInput{JsonBytes: input})
+		if err == nil {
+			t.Errorf("expected error for custom input %s", input)
+		}
+	}
+}
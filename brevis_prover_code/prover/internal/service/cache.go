@@ -0,0 +1,240 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"prover/internal/metrics"
+
+	"github.com/brevis-network/brevis-sdk/sdk/proto/commonproto"
+	"github.com/brevis-network/brevis-sdk/sdk/proto/sdkproto"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"google.golang.org/protobuf/proto"
+)
+
+// proofCache persists completed proofs so identical requests are not proven
+// again. Proofs are keyed by the VK hash of the circuit followed by the hash
+// of the profile's parameters and the request, so the proofs of a circuit can
+// be evicted together.
+type proofCache struct {
+	db *leveldb.DB
+	// entries and bytes count the stored proofs, keys included
+	entries int
+	bytes   int64
+	lock    sync.Mutex
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type cachedProof struct {
+	Proof string `json:"proof"`
+	// CircuitInfo is the protobuf encoded commonproto.AppCircuitInfo
+	CircuitInfo []byte    `json:"circuit_info"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CacheStats describes the proof cache
+type CacheStats struct {
+	Entries int    `json:"entries"`
+	Bytes   int64  `json:"bytes"`
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+}
+
+func openProofCache(dir string) (*proofCache, error) {
+	db, err := leveldb.OpenFile(dir, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open proof cache %s: %s", dir, err.Error())
+	}
+	c := &proofCache{db: db}
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		c.entries++
+		c.bytes += int64(len(it.Key()) + len(it.Value()))
+	}
+	if err = it.Error(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to read proof cache %s: %s", dir, err.Error())
+	}
+	c.updateMetrics()
+	return c, nil
+}
+
+// proofKey returns the cache key of the request proven by the profile. The
+// request is normalized to the profile's chain, since requests without a
+// source chain are proven for it. All profiles of a kind share one circuit and
+// VK hash, so the key also covers the profile's parameters, which the custom
+// inputs of the proof default to.
+func proofKey(pc *profileCircuit, req *sdkproto.ProveRequest) (string, error) {
+	req = proto.Clone(req).(*sdkproto.ProveRequest)
+	req.SrcChainId = pc.profile.ChainId
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	params, err := json.Marshal(pc.profile.Params)
+	if err != nil {
+		return "", err
+	}
+	return pc.setup.vkHash + "/" + crypto.Keccak256Hash(crypto.Keccak256(params), data).Hex(), nil
+}
+
+func (c *proofCache) get(key string) (string, *commonproto.AppCircuitInfo, bool) {
+	data, err := c.db.Get([]byte(key), nil)
+	if err != nil {
+		if err != leveldb.ErrNotFound {
+			fmt.Printf("failed to read cached proof %s: %s\n", key, err.Error())
+		}
+		c.misses.Add(1)
+		metrics.CacheMisses.Inc()
+		return "", nil, false
+	}
+	var entry cachedProof
+	info := &commonproto.AppCircuitInfo{}
+	if err = json.Unmarshal(data, &entry); err == nil {
+		err = proto.Unmarshal(entry.CircuitInfo, info)
+	}
+	if err != nil {
+		fmt.Printf("invalid cached proof %s: %s\n", key, err.Error())
+		c.misses.Add(1)
+		metrics.CacheMisses.Inc()
+		return "", nil, false
+	}
+	c.hits.Add(1)
+	metrics.CacheHits.Inc()
+	return entry.Proof, info, true
+}
+
+func (c *proofCache) put(key, proof string, info *commonproto.AppCircuitInfo) error {
+	encodedInfo, err := proto.Marshal(info)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(cachedProof{Proof: proof, CircuitInfo: encodedInfo, CreatedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	old, err := c.db.Get([]byte(key), nil)
+	if err == nil {
+		c.entries--
+		c.bytes -= int64(len(key) + len(old))
+	} else if err != leveldb.ErrNotFound {
+		return err
+	}
+	if err = c.db.Put([]byte(key), data, nil); err != nil {
+		return err
+	}
+	c.entries++
+	c.bytes += int64(len(key) + len(data))
+	c.updateMetrics()
+	return nil
+}
+
+// evict deletes the proofs of the circuit with the VK hash, or of all circuits
+// if vkHash is empty, that were cached before the time. It returns the number
+// of proofs deleted.
+func (c *proofCache) evict(vkHash string, before time.Time) (int, error) {
+	var prefix *util.Range
+	if vkHash != "" {
+		prefix = util.BytesPrefix([]byte(strings.ToLower(vkHash) + "/"))
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	batch := new(leveldb.Batch)
+	var bytes int64
+	it := c.db.NewIterator(prefix, nil)
+	for it.Next() {
+		var entry cachedProof
+		if err := json.Unmarshal(it.Value(), &entry); err == nil && !entry.CreatedAt.Before(before) {
+			continue
+		}
+		batch.Delete(append([]byte(nil), it.Key()...))
+		bytes += int64(len(it.Key()) + len(it.Value()))
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return 0, err
+	}
+	if err := c.db.Write(batch, nil); err != nil {
+		return 0, err
+	}
+	c.entries -= batch.Len()
+	c.bytes -= bytes
+	c.updateMetrics()
+	return batch.Len(), nil
+}
+
+func (c *proofCache) updateMetrics() {
+	metrics.CacheEntries.Set(float64(c.entries))
+	metrics.CacheBytes.Set(float64(c.bytes))
+}
+
+func (c *proofCache) stats() CacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return CacheStats{Entries: c.entries, Bytes: c.bytes, Hits: c.hits.Load(), Misses: c.misses.Load()}
+}
+
+func (c *proofCache) close() error {
+	return c.db.Close()
+}
+
+// lookupProof returns the cache key of the request and its cached proof and
+// circuit info, if it was proven before. The key is empty if the service has
+// no cache.
+func (s *Service) lookupProof(pc *profileCircuit, req *sdkproto.ProveRequest) (string, string, *commonproto.AppCircuitInfo) {
+	if s.cache == nil {
+		return "", "", nil
+	}
+	key, err := proofKey(pc, req)
+	if err != nil {
+		fmt.Println("failed to compute proof cache key:", err.Error())
+		return "", "", nil
+	}
+	proof, info, ok := s.cache.get(key)
+	if !ok {
+		return key, "", nil
+	}
+	return key, proof, info
+}
+
+// cacheProof stores a completed proof under the key returned by lookupProof
+func (s *Service) cacheProof(key, proof string, info *commonproto.AppCircuitInfo) {
+	if key == "" {
+		return
+	}
+	if err := s.cache.put(key, proof, info); err != nil {
+		fmt.Printf("failed to cache proof %s: %s\n", key, err.Error())
+	}
+}
+
+// CacheStats returns the number and size of the cached proofs and how often
+// requests were answered from the cache since the service started
+func (s *Service) CacheStats() CacheStats {
+	if s.cache == nil {
+		return CacheStats{}
+	}
+	return s.cache.stats()
+}
+
+// EvictProofs deletes the cached proofs of the circuit with the VK hash, or of
+// all circuits if vkHash is empty, that are older than maxAge. It returns the
+// number of proofs deleted.
+func (s *Service) EvictProofs(vkHash string, maxAge time.Duration) (int, error) {
+	if s.cache == nil {
+		return 0, nil
+	}
+	return s.cache.evict(vkHash, time.Now().Add(-maxAge))
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"prover/circuits"
+
+	"github.com/brevis-network/brevis-sdk/sdk/proto/commonproto"
+	"github.com/brevis-network/brevis-sdk/sdk/proto/sdkproto"
+)
+
+func TestProofCache(t *testing.T) {
+	dir := t.TempDir()
+	c, err := openProofCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Versions of a profile share the circuit and VK hash of their kind, but
+	// not their parameters
+	v1 := circuits.DefaultProfile()
+	v2 := v1
+	v2.Version = 2
+	v2.Params.MinVolume = big.NewInt(1_000_000_000)
+	pair := &setup{vkHash: "0x01"}
+	usdc := &profileCircuit{profile: v1, setup: pair}
+	raised := &profileCircuit{profile: v2, setup: pair}
+	volume := &profileCircuit{
+		profile: circuits.Profile{Name: "usdc-volume", Version: 1, Kind: circuits.KindTradingVolume, ChainId: 1, Params: v1.Params},
+		setup:   &setup{vkHash: "0x02"},
+	}
+	req := &sdkproto.ProveRequest{Receipts: []*sdkproto.IndexedReceipt{{Index: 0, Data: &sdkproto.ReceiptData{TxHash: "0xa1"}}}}
+	key := func(pc *profileCircuit, req *sdkproto.ProveRequest) string {
+		k, err := proofKey(pc, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+
+	// Requests naming the profile's chain are the same request. Requests
+	// proven with other parameters or by another circuit are not.
+	onChain := &sdkproto.ProveRequest{Receipts: req.Receipts, SrcChainId: 1}
+	if key(usdc, req) != key(usdc, onChain) {
+		t.Error("expected the source chain to default to the profile's")
+	}
+	if key(usdc, req) == key(raised, req) {
+		t.Error("expected profiles with different parameters to have different keys")
+	}
+	if key(usdc, req) == key(volume, req) {
+		t.Error("expected the circuits to have different keys")
+	}
+	renamed := &profileCircuit{profile: v1, setup: pair}
+	renamed.profile.Name = "usdc-usdt-copy"
+	if key(usdc, req) != key(renamed, req) {
+		t.Error("expected profiles with the same parameters to share proofs")
+	}
+
+	if _, _, ok := c.get(key(usdc, req)); ok {
+		t.Fatal("expected an empty cache")
+	}
+	info := &commonproto.AppCircuitInfo{Output: "0x1234", VkHash: "0x01"}
+	for _, pc := range []*profileCircuit{usdc, volume} {
+		if err = c.put(key(pc, req), "0xabcd", info); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, ok := c.get(key(raised, req)); ok {
+		t.Error("expected no proof for the raised minimum volume")
+	}
+	// Overwriting a proof keeps a single entry
+	if err = c.put(key(usdc, req), "0xabcd", info); err != nil {
+		t.Fatal(err)
+	}
+	proof, cached, ok := c.get(key(usdc, req))
+	if !ok || proof != "0xabcd" || cached.Output != "0x1234" {
+		t.Errorf("got proof %s with info %v", proof, cached)
+	}
+	stats := c.stats()
+	if stats.Entries != 2 || stats.Hits != 1 || stats.Misses != 2 || stats.Bytes == 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	// Proofs survive restarts
+	if err = c.close(); err != nil {
+		t.Fatal(err)
+	}
+	if c, err = openProofCache(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+	if restored := c.stats(); restored.Entries != 2 || restored.Bytes != stats.Bytes {
+		t.Errorf("reopened cache has stats %+v, want %+v", restored, stats)
+	}
+
+	// Eviction is limited to the circuit and proof age
+	if n, err := c.evict("0x01", time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("evicted %d recent proofs, %v", n, err)
+	}
+	if n, err := c.evict("0x01", time.Now()); err != nil || n != 1 {
+		t.Errorf("evicted %d proofs of the circuit, %v", n, err)
+	}
+	if _, _, ok = c.get(key(volume, req)); !ok {
+		t.Error("expected the other circuit's proof to be kept")
+	}
+	if n, err := c.evict("", time.Now()); err != nil || n != 1 || c.stats().Entries != 0 || c.stats().Bytes != 0 {
+		t.Errorf("evicted %d proofs, %v, stats %+v", n, err, c.stats())
+	}
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+)
+
+// Config configures the prover service
+type Config struct {
+	// SetupDir stores the profiles, their proving and verifying keys, the
+	// cached proofs, the job journal and the data queried from the chains. It
+	// may reference environment variables such as $HOME.
+	SetupDir string
+	// SrsDir stores the downloaded SRS files and defaults to SetupDir. It may
+	// reference environment variables too.
+	SrsDir string
+	// Chains are the source chains proofs can be requested for
+	Chains []Chain
+	// ProveWorkers is the number of proofs generated at once, 1 if not set
+	ProveWorkers int
+}
+
+// Chain is a source chain served by the prover
+type Chain struct {
+	ChainId uint64
+	RpcURL  string
+}
+
+func (c Config) setupDir() string {
+	return os.ExpandEnv(c.SetupDir)
+}
+
+func (c Config) srsDir() string {
+	if c.SrsDir == "" {
+		return c.setupDir()
+	}
+	return os.ExpandEnv(c.SrsDir)
+}
+
+func (c Config) proveWorkers() int {
+	if c.ProveWorkers < 1 {
+		return 1
+	}
+	return c.ProveWorkers
+}
+
+// chainApp queries the data of proof requests from one source chain
+type chainApp struct {
+	chain Chain
+	app   *sdk.BrevisApp
+	// the brevis app accumulates request data and must not be shared between requests
+	lock sync.Mutex
+}
+
+// newChainApp connects to the chain. Each chain caches the data it queried in
+// its own directory under setupDir.
+func newChainApp(c Chain, setupDir string) (*chainApp, error) {
+	dir := filepath.Join(setupDir, "input", strconv.FormatUint(c.ChainId, 10))
+	app, err := sdk.NewBrevisApp(c.ChainId, c.RpcURL, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initiate brevis app for chain %d: %s", c.ChainId, err.Error())
+	}
+	return &chainApp{chain: c, app: app}, nil
+}
+
+// ChainInfo describes a source chain served by the prover
+type ChainInfo struct {
+	ChainId uint64 `json:"chain_id"`
+	// DefaultProfile proves requests for the chain that do not name a profile
+	DefaultProfile string `json:"default_profile"`
+}
+
+// Chains returns the served source chains ordered by chain id
+func (s *Service) Chains() []ChainInfo {
+	ps := s.profiles.load()
+	chains := make([]ChainInfo, 0, len(s.chains))
+	for id := range s.chains {
+		chains = append(chains, ChainInfo{ChainId: id, DefaultProfile: ps.chainDefaults[id]})
+	}
+	sort.Slice(chains, func(i, j int) bool { return chains[i].ChainId < chains[j].ChainId })
+	return chains
+}
+
+// servesChain returns whether proofs can be requested for the chain
+func (s *Service) servesChain(chainId uint64) bool {
+	_, ok := s.chains[chainId]
+	return ok
+}
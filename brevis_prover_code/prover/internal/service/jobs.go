@@ -0,0 +1,284 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"prover/internal/metrics"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/brevis-network/brevis-sdk/sdk/proto/commonproto"
+	"github.com/brevis-network/brevis-sdk/sdk/proto/sdkproto"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/hashicorp/go-uuid"
+)
+
+// JobStatus is the state of a proof job
+type JobStatus string
+
+const (
+	// JobQueued jobs wait for a free prover worker
+	JobQueued  JobStatus = "queued"
+	JobProving JobStatus = "proving"
+	JobDone    JobStatus = "done"
+	JobFailed  JobStatus = "failed"
+)
+
+// jobRetention is how long finished jobs can still be polled
+const jobRetention = time.Hour
+
+// Job is a proof request proven in the background by the prover workers
+type Job struct {
+	ID      string    `json:"id"`
+	Status  JobStatus `json:"status"`
+	Profile string    `json:"profile"`
+	ChainId uint64    `json:"chain_id"`
+	VkHash  string    `json:"vk_hash"`
+	// Output is the hex encoded packed circuit output, known as soon as the
+	// job is submitted. Proof is set once the job is done, Error once it
+	// failed.
+	Output string `json:"output"`
+	Proof  string `json:"proof,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Cached is set if the proof was taken from the proof cache
+	Cached bool `json:"cached"`
+
+	SubmittedAt time.Time `json:"submitted_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type job struct {
+	Job
+	info *commonproto.AppCircuitInfo
+	// cacheKey stores the proof in the proof cache, empty if not cached
+	cacheKey string
+	// the request is journaled until the job finishes, attempts counts how
+	// often proving it started
+	req      *sdkproto.ProveRequest
+	attempts int
+	// the circuit input, released once the job is proven
+	st    *setup
+	input *sdk.CircuitInput
+	guest sdk.AppCircuit
+}
+
+// jobQueue holds the jobs of the service. Queued jobs are proven in
+// submission order. Every change of a job is written to the journal, if any.
+type jobQueue struct {
+	jobs    map[string]*job
+	queue   []*job
+	journal *jobJournal
+	stopped bool
+	lock    sync.Mutex
+	ready   *sync.Cond
+}
+
+func newJobQueue(journal *jobJournal) *jobQueue {
+	q := &jobQueue{jobs: make(map[string]*job), journal: journal}
+	q.ready = sync.NewCond(&q.lock)
+	return q
+}
+
+// SubmitJob builds the circuit input for the request and queues it for
+// proving. The profile with the id proves the request, or the default profile
+// of the request's source chain if the id is empty. Invalid requests are
+// rejected right away, requests proven before are done right away.
+func (s *Service) SubmitJob(profileId string, req *sdkproto.ProveRequest) (Job, *sdkproto.Err) {
+	pc, protoErr := s.resolveProfileID(profileId, req.SrcChainId)
+	profile := countRequest(pc)
+	if protoErr != nil {
+		countFailure(profile, protoErr.Code)
+		return Job{}, protoErr
+	}
+	j, protoErr := s.submitJob(pc, req)
+	if protoErr != nil {
+		countFailure(profile, protoErr.Code)
+		return Job{}, protoErr
+	}
+	return s.jobs.get(j.ID)
+}
+
+func (s *Service) submitJob(pc *profileCircuit, req *sdkproto.ProveRequest) (*job, *sdkproto.Err) {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, newErr(sdkproto.ErrCode_ERROR_DEFAULT, "failed to generate uuid %s", err.Error())
+	}
+	now := time.Now()
+	j := &job{
+		Job: Job{
+			ID:          id,
+			Profile:     pc.profile.ID(),
+			ChainId:     pc.profile.ChainId,
+			VkHash:      pc.setup.vkHash,
+			SubmittedAt: now,
+			UpdatedAt:   now,
+		},
+		req: req,
+	}
+	if protoErr := s.prepareJob(j, pc); protoErr != nil {
+		return nil, protoErr
+	}
+	if j.Status == JobDone {
+		countSuccess(j.Profile)
+	}
+	s.jobs.push(j)
+	return j, nil
+}
+
+// prepareJob marks the job as done if its request was proven before, and
+// otherwise builds its circuit input and marks it as queued
+func (s *Service) prepareJob(j *job, pc *profileCircuit) *sdkproto.Err {
+	key, proof, info := s.lookupProof(pc, j.req)
+	if info != nil {
+		j.Status = JobDone
+		j.Output = info.Output
+		j.Proof = proof
+		j.Cached = true
+		j.info = info
+		j.req = nil
+		return nil
+	}
+
+	input, guest, witness, protoErr := s.buildInput(j.req, pc.circuit, s.chains[pc.profile.ChainId])
+	if protoErr != nil {
+		return protoErr
+	}
+	j.Status = JobQueued
+	j.Output = hexutil.Encode(input.GetAbiPackedOutput())
+	j.info = buildAppCircuitInfo(pc.circuit, *input, pc.setup.vkString, pc.setup.vkHash, witness)
+	j.cacheKey = key
+	j.st, j.input, j.guest = pc.setup, input, guest
+	return nil
+}
+
+// Job returns the job with the id. Finished jobs are forgotten after an hour.
+func (s *Service) Job(id string) (Job, bool) {
+	j, protoErr := s.jobs.get(id)
+	return j, protoErr == nil
+}
+
+// startWorkers starts proving queued jobs with n workers
+func (s *Service) startWorkers(n int) {
+	s.proving.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer s.proving.Done()
+			s.work()
+		}()
+	}
+}
+
+// work proves queued jobs until the service shuts down
+func (s *Service) work() {
+	for {
+		j := s.jobs.next()
+		if j == nil {
+			return
+		}
+		proof, err := s.prove(j.Profile, j.st, j.input, j.guest)
+		if err != nil {
+			fmt.Printf("failed to prove job %s: %s\n", j.ID, err.Error())
+			countFailure(j.Profile, sdkproto.ErrCode_ERROR_FAILED_TO_PROVE)
+		} else {
+			s.cacheProof(j.cacheKey, proof, j.info)
+			countSuccess(j.Profile)
+		}
+		s.jobs.finish(j, proof, err)
+	}
+}
+
+// push adds the job, queueing it for proving unless it is finished already
+func (q *jobQueue) push(j *job) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.prune(time.Now())
+	q.jobs[j.ID] = j
+	q.save(j)
+	if j.Status == JobQueued {
+		q.queue = append(q.queue, j)
+		metrics.JobsQueued.Set(float64(len(q.queue)))
+		q.ready.Signal()
+	}
+}
+
+func (q *jobQueue) get(id string) (Job, *sdkproto.Err) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return Job{}, newErr(sdkproto.ErrCode_ERROR_INVALID_INPUT, "unknown job %s", id)
+	}
+	return j.Job, nil
+}
+
+// next waits for a queued job and marks it as proving. It returns nil once the
+// queue is stopped.
+func (q *jobQueue) next() *job {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for len(q.queue) == 0 && !q.stopped {
+		q.ready.Wait()
+	}
+	if q.stopped {
+		return nil
+	}
+	j := q.queue[0]
+	q.queue[0] = nil
+	q.queue = q.queue[1:]
+	metrics.JobsQueued.Set(float64(len(q.queue)))
+	j.Status = JobProving
+	j.UpdatedAt = time.Now()
+	j.attempts++
+	q.save(j)
+	return j
+}
+
+func (q *jobQueue) finish(j *job, proof string, err error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	j.req, j.input, j.guest = nil, nil, nil
+	j.UpdatedAt = time.Now()
+	if err != nil {
+		j.Status = JobFailed
+		j.Error = err.Error()
+	} else {
+		j.Status = JobDone
+		j.Proof = proof
+	}
+	q.save(j)
+}
+
+// save journals the job. Failing to do so only loses the job on restart, so
+// the error is just logged.
+func (q *jobQueue) save(j *job) {
+	if q.journal == nil {
+		return
+	}
+	if err := q.journal.save(j); err != nil {
+		fmt.Printf("failed to journal job %s: %s\n", j.ID, err.Error())
+	}
+}
+
+// prune forgets the jobs finished longer than jobRetention before now
+func (q *jobQueue) prune(now time.Time) {
+	for id, j := range q.jobs {
+		if (j.Status == JobDone || j.Status == JobFailed) && now.Sub(j.UpdatedAt) > jobRetention {
+			delete(q.jobs, id)
+			if q.journal != nil {
+				if err := q.journal.delete(id); err != nil {
+					fmt.Printf("failed to delete journaled job %s: %s\n", id, err.Error())
+				}
+			}
+		}
+	}
+}
+
+// stop makes the workers exit once they finished their current job. Queued
+// jobs stay journaled for the next start.
+func (q *jobQueue) stop() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.stopped = true
+	q.ready.Broadcast()
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"prover/circuits"
+
+	"github.com/brevis-network/brevis-sdk/sdk/proto/commonproto"
+	"github.com/brevis-network/brevis-sdk/sdk/proto/sdkproto"
+)
+
+func TestJobQueue(t *testing.T) {
+	q := newJobQueue(nil)
+	submitted := time.Now()
+	for _, id := range []string{"a", "b", "c"} {
+		q.push(&job{Job: Job{ID: id, Status: JobQueued, SubmittedAt: submitted, UpdatedAt: submitted}})
+	}
+
+	// Jobs are proven in submission order
+	a, b := q.next(), q.next()
+	if a.ID != "a" || b.ID != "b" {
+		t.Fatalf("got jobs %s and %s, want a and b", a.ID, b.ID)
+	}
+	q.finish(a, "0x01", nil)
+	q.finish(b, "", errors.New("out of memory"))
+
+	for id, want := range map[string]Job{
+		"a": {Status: JobDone, Proof: "0x01"},
+		"b": {Status: JobFailed, Error: "out of memory"},
+		"c": {Status: JobQueued},
+	} {
+		got, err := q.get(id)
+		if err != nil {
+			t.Fatal(err.Msg)
+		}
+		if got.Status != want.Status || got.Proof != want.Proof || got.Error != want.Error {
+			t.Errorf("job %s is %+v, want %+v", id, got, want)
+		}
+	}
+	if _, err := q.get("d"); err == nil {
+		t.Error("expected an unknown job to be rejected")
+	}
+
+	// Finished jobs are forgotten after the retention period, queued ones are
+	// kept
+	q.prune(time.Now().Add(jobRetention + time.Minute))
+	if _, err := q.get("a"); err == nil {
+		t.Error("expected a finished job to be pruned")
+	}
+	if _, err := q.get("c"); err != nil {
+		t.Error("expected a queued job to be kept")
+	}
+
+	// Stopping the queue releases waiting workers
+	c := q.next()
+	done := make(chan *job)
+	go func() { done <- q.next() }()
+	q.stop()
+	select {
+	case j := <-done:
+		if j != nil {
+			t.Errorf("got job %s from a stopped queue", j.ID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("worker is still waiting after the queue stopped")
+	}
+	if c.Status != JobProving {
+		t.Errorf("job c is %s, want proving", c.Status)
+	}
+}
+
+func TestSubmitJobRejectsInvalidRequests(t *testing.T) {
+	usdc := circuits.DefaultProfile()
+	s := &Service{
+		chains: map[uint64]*chainApp{1: {}},
+		profiles: newProfileStore(&profileSet{
+			profiles:       map[string]*profileCircuit{usdc.ID(): {profile: usdc, setup: &setup{}}},
+			defaultProfile: usdc.ID(),
+			chainDefaults:  map[uint64]string{1: usdc.ID()},
+		}),
+		jobs: newJobQueue(nil),
+	}
+	for _, tt := range []struct {
+		profile string
+		chainId uint64
+	}{
+		{"weth-usdc-v1", 0},
+		{"", 10},
+	} {
+		_, protoErr := s.SubmitJob(tt.profile, &sdkproto.ProveRequest{SrcChainId: tt.chainId})
+		if protoErr == nil || protoErr.Code != sdkproto.ErrCode_ERROR_INVALID_INPUT {
+			t.Errorf("profile %q on chain %d: expected invalid input error, got %v", tt.profile, tt.chainId, protoErr)
+		}
+	}
+	if len(s.jobs.jobs) != 0 {
+		t.Errorf("rejected requests were queued: %v", s.jobs.jobs)
+	}
+}
+
+func TestRestoreJobs(t *testing.T) {
+	dir := t.TempDir()
+	journal, err := openJobJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := openProofCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.close()
+
+	usdc := circuits.DefaultProfile()
+	pc := &profileCircuit{profile: usdc, setup: &setup{vkHash: "0x01"}}
+	req := &sdkproto.ProveRequest{Receipts: []*sdkproto.IndexedReceipt{{Data: &sdkproto.ReceiptData{TxHash: "0xa1"}}}}
+	key, err := proofKey(pc, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The proof was cached right before the restart
+	if err = cache.put(key, "0xabcd", &commonproto.AppCircuitInfo{Output: "0x1234"}); err != nil {
+		t.Fatal(err)
+	}
+
+	submitted := time.Now().Add(-time.Minute)
+	q := newJobQueue(journal)
+	for _, j := range []*job{
+		{Job: Job{ID: "done", Status: JobDone, Profile: usdc.ID(), Proof: "0x01"}},
+		{Job: Job{ID: "cached", Status: JobQueued, Profile: usdc.ID()}, req: req},
+		{Job: Job{ID: "crashing", Status: JobQueued, Profile: usdc.ID()}, req: req, attempts: maxJobAttempts - 1},
+		{Job: Job{ID: "removed", Status: JobQueued, Profile: "weth-usdc-v1"}, req: req},
+	} {
+		j.SubmittedAt, j.UpdatedAt = submitted, submitted
+		q.push(j)
+	}
+	// The prover restarts while proving the first two jobs, for the last time
+	// it may try the second
+	if q.next().ID != "cached" || q.next().ID != "crashing" {
+		t.Fatal("unexpected job order")
+	}
+	q.stop()
+	if err = journal.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if journal, err = openJobJournal(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer journal.close()
+	s := &Service{
+		profiles: newProfileStore(&profileSet{profiles: map[string]*profileCircuit{usdc.ID(): pc}}),
+		jobs:     newJobQueue(journal),
+		cache:    cache,
+	}
+	if err = s.restoreJobs(); err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[string]JobStatus{
+		"done":     JobDone,
+		"cached":   JobDone,
+		"crashing": JobFailed,
+		"removed":  JobFailed,
+	} {
+		j, ok := s.Job(id)
+		if !ok {
+			t.Errorf("job %s was not restored", id)
+			continue
+		}
+		if j.Status != want {
+			t.Errorf("job %s is %s, want %s", id, j.Status, want)
+		}
+		if j.Status == JobFailed && j.Error == "" {
+			t.Errorf("job %s failed without a reason", id)
+		}
+	}
+	if j, _ := s.Job("cached"); j.Proof != "0xabcd" || j.Output != "0x1234" || !j.Cached {
+		t.Errorf("unexpected cached job %+v", j)
+	}
+	if len(s.jobs.queue) != 0 {
+		t.Errorf("%d jobs were queued again", len(s.jobs.queue))
+	}
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/brevis-network/brevis-sdk/sdk/proto/sdkproto"
+	"github.com/syndtr/goleveldb/leveldb"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxJobAttempts is the number of times a job is proven before it is failed.
+// A job interrupted by a restart is proven again, unless it crashed the prover
+// that often.
+const maxJobAttempts = 3
+
+// jobJournal persists the jobs by id so they survive restarts
+type jobJournal struct {
+	db *leveldb.DB
+}
+
+type journaledJob struct {
+	Job
+	// Request is the protobuf encoded proof request of an unfinished job
+	Request  []byte `json:"request,omitempty"`
+	Attempts int    `json:"attempts"`
+}
+
+func openJobJournal(dir string) (*jobJournal, error) {
+	db, err := leveldb.OpenFile(dir, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job journal %s: %s", dir, err.Error())
+	}
+	return &jobJournal{db: db}, nil
+}
+
+func (jr *jobJournal) save(j *job) error {
+	record := journaledJob{Job: j.Job, Attempts: j.attempts}
+	if j.req != nil {
+		request, err := proto.Marshal(j.req)
+		if err != nil {
+			return err
+		}
+		record.Request = request
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return jr.db.Put([]byte(j.ID), data, nil)
+}
+
+func (jr *jobJournal) delete(id string) error {
+	return jr.db.Delete([]byte(id), nil)
+}
+
+// load returns the journaled jobs in submission order
+func (jr *jobJournal) load() ([]journaledJob, error) {
+	var records []journaledJob
+	it := jr.db.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		var record journaledJob
+		if err := json.Unmarshal(it.Value(), &record); err != nil {
+			return nil, fmt.Errorf("invalid journaled job %s: %s", it.Key(), err.Error())
+		}
+		records = append(records, record)
+	}
+	if err := it.Error(); err != nil {
+		return nil, fmt.Errorf("failed to read job journal: %s", err.Error())
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].SubmittedAt.Before(records[j].SubmittedAt) })
+	return records, nil
+}
+
+func (jr *jobJournal) close() error {
+	return jr.db.Close()
+}
+
+// restoreJobs restores the journaled jobs. Jobs that were queued or proving
+// when the service stopped are queued again, or failed with the reason they
+// cannot be resumed, so clients polling them get a definitive answer.
+func (s *Service) restoreJobs() error {
+	records, err := s.jobs.journal.load()
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		j := &job{Job: r.Job, attempts: r.Attempts}
+		if j.Status == JobQueued || j.Status == JobProving {
+			if reason := s.resumeJob(j, r.Request); reason != "" {
+				fmt.Printf("failed to resume job %s: %s\n", j.ID, reason)
+				j.Status = JobFailed
+				j.Error = reason
+			}
+			j.UpdatedAt = time.Now()
+		}
+		s.jobs.push(j)
+	}
+	return nil
+}
+
+// resumeJob prepares an unfinished job for proving again. It returns why the
+// job cannot be resumed, if it cannot.
+func (s *Service) resumeJob(j *job, request []byte) string {
+	if j.Status == JobProving && j.attempts >= maxJobAttempts {
+		return fmt.Sprintf("the prover restarted while proving the job %d times", j.attempts)
+	}
+	pc, ok := s.profiles.load().profiles[j.Profile]
+	if !ok {
+		return fmt.Sprintf("profile %s is no longer served after a restart", j.Profile)
+	}
+	req := &sdkproto.ProveRequest{}
+	if err := proto.Unmarshal(request, req); err != nil {
+		return fmt.Sprintf("invalid journaled request: %s", err.Error())
+	}
+	j.req = req
+	if protoErr := s.prepareJob(j, pc); protoErr != nil {
+		return fmt.Sprintf("failed to resume the job after a restart: %s", protoErr.Msg)
+	}
+	return ""
+}
@@ -0,0 +1,355 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"prover/circuits"
+	"prover/internal/metrics"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/brevis-network/brevis-sdk/sdk/proto/sdkproto"
+	"google.golang.org/grpc/metadata"
+)
+
+// ProfileMetadataKey is the GRPC metadata key selecting the profile a proof
+// request is proven with. REST clients set it with the X-Profile-Id header.
+const ProfileMetadataKey = "profile-id"
+
+// ErrUnknownProfile is returned when a profile id is not served
+var ErrUnknownProfile = errors.New("unknown profile")
+
+// profileCircuit is a profile together with its compiled circuit. circuit is
+// assigned the profile's parameters, which proof requests may override with
+// their custom input.
+type profileCircuit struct {
+	profile circuits.Profile
+	circuit sdk.AppCircuit
+	setup   *setup
+}
+
+// ProfileInfo describes a profile served by the prover
+type ProfileInfo struct {
+	circuits.Profile
+	ID      string `json:"id"`
+	VkHash  string `json:"vk_hash"`
+	Default bool   `json:"default"`
+	// ChainDefault is set if the profile proves requests for its chain that do
+	// not name a profile
+	ChainDefault bool `json:"chain_default"`
+	// Revision is the revision of the profiles the info was read at
+	Revision uint64 `json:"revision"`
+}
+
+// storedProfiles is the profile index persisted in SetupDir
+type storedProfiles struct {
+	// Revision is the revision of the profiles when they were stored
+	Revision      uint64             `json:"revision"`
+	Default       string             `json:"default"`
+	ChainDefaults map[uint64]string  `json:"chain_defaults,omitempty"`
+	Profiles      []circuits.Profile `json:"profiles"`
+}
+
+func (stored storedProfiles) hasChain(chainId uint64) bool {
+	for _, p := range stored.Profiles {
+		if p.ChainId == chainId {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) profilesPath() string {
+	return filepath.Join(s.config.setupDir(), "profiles.json")
+}
+
+func readProfiles(path string) (storedProfiles, error) {
+	var stored storedProfiles
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return stored, nil
+	}
+	if err != nil {
+		return stored, fmt.Errorf("failed to read profiles: %s", err.Error())
+	}
+	if err = json.Unmarshal(data, &stored); err != nil {
+		return stored, fmt.Errorf("failed to decode profiles %s: %s", path, err.Error())
+	}
+	return stored, nil
+}
+
+// stored returns the profile index of the profiles
+func (ps *profileSet) stored() storedProfiles {
+	stored := storedProfiles{Revision: ps.revision, Default: ps.defaultProfile, ChainDefaults: ps.chainDefaults}
+	for _, pc := range ps.profiles {
+		stored.Profiles = append(stored.Profiles, pc.profile)
+	}
+	sort.Slice(stored.Profiles, func(i, j int) bool {
+		return stored.Profiles[i].ID() < stored.Profiles[j].ID()
+	})
+	return stored
+}
+
+// restoreProfiles returns the profiles served at startup: the set up profiles
+// with the defaults of the stored index. Without a stored default the first
+// profile is the default, and chains without one default to their first
+// profile by id. The revision only advances if the profiles differ from the
+// stored ones, so a restart keeps the revisions clients hold valid.
+func restoreProfiles(stored storedProfiles, pcs []*profileCircuit) (*profileSet, error) {
+	ps := &profileSet{
+		revision:      stored.Revision,
+		profiles:      make(map[string]*profileCircuit, len(pcs)),
+		chainDefaults: make(map[uint64]string),
+	}
+	for _, pc := range pcs {
+		if err := ps.add(pc); err != nil {
+			return nil, err
+		}
+	}
+	id := stored.Default
+	if id == "" && len(pcs) > 0 {
+		id = pcs[0].profile.ID()
+	}
+	pc, ok := ps.profiles[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: stored default profile %s", ErrUnknownProfile, id)
+	}
+	ps.setDefault(pc)
+
+	for chainId, id := range stored.ChainDefaults {
+		pc, ok := ps.profiles[id]
+		if !ok || pc.profile.ChainId != chainId {
+			return nil, fmt.Errorf("stored default profile %s of chain %d is not a profile of the chain", id, chainId)
+		}
+		ps.chainDefaults[chainId] = id
+	}
+	ids := make([]string, 0, len(ps.profiles))
+	for id := range ps.profiles {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		chainId := ps.profiles[id].profile.ChainId
+		if _, ok := ps.chainDefaults[chainId]; !ok {
+			ps.chainDefaults[chainId] = id
+		}
+	}
+
+	// compare the encodings, which is what is stored
+	before, err := json.Marshal(stored)
+	if err != nil {
+		return nil, err
+	}
+	after, err := json.Marshal(ps.stored())
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(before, after) {
+		ps.revision++
+	}
+	return ps, nil
+}
+
+// writeProfiles persists the profile index
+func (s *Service) writeProfiles(ps *profileSet) error {
+	data, err := json.MarshalIndent(ps.stored(), "", "  ")
+	if err != nil {
+		return err
+	}
+	path := s.profilesPath()
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// write to a temporary file first so a crash never leaves a truncated index
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// setupProfile compiles the profile's circuit and sets it up, reusing the
+// setup of other profiles compiling to the same circuit
+func (s *Service) setupProfile(p circuits.Profile) (*profileCircuit, error) {
+	if err := s.ValidateProfile(p); err != nil {
+		return nil, err
+	}
+
+	// compiling assigns the circuit's variables, so it gets its own copy
+	compiled, _ := p.Circuit()
+	circuit, _ := p.Circuit()
+	st, err := s.setupCircuit(compiled)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up profile %s: %s", p.ID(), err.Error())
+	}
+	fmt.Printf("profile %s set up, vk hash %s\n", p.ID(), st.vkHash)
+	return &profileCircuit{profile: p, circuit: circuit, setup: st}, nil
+}
+
+// setCircuitInfo publishes the chain and VK hash of a served profile
+func setCircuitInfo(pc *profileCircuit) {
+	metrics.CircuitInfo.WithLabelValues(pc.profile.ID(), strconv.FormatUint(pc.profile.ChainId, 10), pc.setup.vkHash).Set(1)
+}
+
+// ValidateProfile checks that the profile can be served without setting it up
+func (s *Service) ValidateProfile(p circuits.Profile) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if !s.servesChain(p.ChainId) {
+		return fmt.Errorf("profile %s is for chain %d, which the prover does not serve", p.ID(), p.ChainId)
+	}
+	return nil
+}
+
+// AddProfile creates the next version of the profile named p.Name with the
+// kind, chain and parameters of p. Existing versions keep being served, so
+// proofs in flight for them are unaffected. It returns the new profile and its
+// VK hash. makeDefault makes it the default of its chain, see
+// SetDefaultProfile; the first profile of a chain always is. Unless revision
+// is AnyRevision, the profile is only added if the profiles are still at that
+// revision, otherwise ErrRevisionMismatch is returned.
+func (s *Service) AddProfile(p circuits.Profile, makeDefault bool, revision uint64) (ProfileInfo, error) {
+	s.setupLock.Lock()
+	defer s.setupLock.Unlock()
+
+	// check the revision before the lengthy setup, and again when adding
+	current := s.profiles.load()
+	if revision != AnyRevision && revision != current.revision {
+		return ProfileInfo{}, revisionMismatch(revision, current.revision)
+	}
+	p.Version = current.latestVersion(p.Name) + 1
+	pc, err := s.setupProfile(p)
+	if err != nil {
+		return ProfileInfo{}, err
+	}
+
+	ps, err := s.profiles.update(revision, func(ps *profileSet) error {
+		if err := ps.add(pc); err != nil {
+			return err
+		}
+		if _, ok := ps.chainDefaults[p.ChainId]; makeDefault || !ok {
+			ps.setDefault(pc)
+		}
+		if err := s.writeProfiles(ps); err != nil {
+			return fmt.Errorf("failed to store profiles: %s", err.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		return ProfileInfo{}, err
+	}
+	setCircuitInfo(pc)
+	return ps.info(pc), nil
+}
+
+// LatestProfile returns the highest version of the named profile
+func (s *Service) LatestProfile(name string) (ProfileInfo, error) {
+	ps := s.profiles.load()
+	version := ps.latestVersion(name)
+	if version == 0 {
+		return ProfileInfo{}, fmt.Errorf("%w: %s", ErrUnknownProfile, name)
+	}
+	return ps.info(ps.profiles[circuits.Profile{Name: name, Version: version}.ID()]), nil
+}
+
+// SetDefaultProfile selects the profile used for requests for its chain that
+// do not name a profile. If the previous default of the chain was also the
+// default for requests without a chain, the profile replaces it there too.
+func (s *Service) SetDefaultProfile(id string) error {
+	_, err := s.profiles.update(AnyRevision, func(ps *profileSet) error {
+		pc, ok := ps.profiles[id]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownProfile, id)
+		}
+		ps.setDefault(pc)
+		return s.writeProfiles(ps)
+	})
+	return err
+}
+
+// Profile returns the profile with the given id
+func (s *Service) Profile(id string) (ProfileInfo, error) {
+	ps := s.profiles.load()
+	pc, ok := ps.profiles[id]
+	if !ok {
+		return ProfileInfo{}, fmt.Errorf("%w: %s", ErrUnknownProfile, id)
+	}
+	return ps.info(pc), nil
+}
+
+// DefaultProfile returns the profile used for requests that do not name one
+func (s *Service) DefaultProfile() ProfileInfo {
+	ps := s.profiles.load()
+	return ps.info(ps.profiles[ps.defaultProfile])
+}
+
+// Profiles returns all served profiles ordered by id
+func (s *Service) Profiles() []ProfileInfo {
+	return s.profiles.load().snapshot().Profiles
+}
+
+// Snapshot returns the served profiles and their defaults as of one revision
+func (s *Service) Snapshot() ProfileSnapshot {
+	return s.profiles.load().snapshot()
+}
+
+// Subscribe returns a channel receiving a snapshot of the profiles after every
+// change, and a function ending the subscription. A subscriber that falls
+// behind only receives the latest snapshot.
+func (s *Service) Subscribe() (<-chan ProfileSnapshot, func()) {
+	return s.profiles.subscribe()
+}
+
+// resolveProfile picks the profile named in the request metadata, falling back
+// to the default profile of the request's source chain, and checks it matches
+// the chain. Requests for chains the prover does not serve are rejected.
+func (s *Service) resolveProfile(ctx context.Context, req *sdkproto.ProveRequest) (*profileCircuit, *sdkproto.Err) {
+	id := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(ProfileMetadataKey); len(values) > 0 {
+			id = values[0]
+		}
+	}
+	return s.resolveProfileID(id, req.SrcChainId)
+}
+
+// resolveProfileID picks the profile with the id, or the default profile of
+// the chain if id is empty
+func (s *Service) resolveProfileID(id string, chainId uint64) (*profileCircuit, *sdkproto.Err) {
+	if chainId != 0 && !s.servesChain(chainId) {
+		return nil, newErr(sdkproto.ErrCode_ERROR_INVALID_INPUT, "chain %d is not served", chainId)
+	}
+	ps := s.profiles.load()
+	if id == "" {
+		id = ps.defaultProfile
+		if chainId != 0 {
+			id = ps.chainDefaults[chainId]
+		}
+	}
+	pc, ok := ps.profiles[id]
+	if !ok {
+		return nil, newErr(sdkproto.ErrCode_ERROR_INVALID_INPUT, "unknown profile %s", id)
+	}
+	if chainId != 0 && chainId != pc.profile.ChainId {
+		return nil, newErr(sdkproto.ErrCode_ERROR_INVALID_INPUT, "profile %s is for chain %d, not %d", id, pc.profile.ChainId, chainId)
+	}
+	return pc, nil
+}
+
+// profileHeaderMatcher forwards the X-Profile-Id header of REST requests to
+// the GRPC server as profile metadata
+func profileHeaderMatcher(key string) (string, bool) {
+	if strings.EqualFold(key, "X-Profile-Id") {
+		return ProfileMetadataKey, true
+	}
+	return "", false
+}
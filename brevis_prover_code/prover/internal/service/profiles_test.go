@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"prover/circuits"
+
+	"github.com/brevis-network/brevis-sdk/sdk/proto/sdkproto"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestResolveProfile(t *testing.T) {
+	usdc := circuits.DefaultProfile()
+	weth := circuits.Profile{Name: "weth-usdc", Version: 2, ChainId: 1, Params: circuits.DefaultParams()}
+	op := circuits.Profile{Name: "op-usdc", Version: 1, ChainId: 10, Params: circuits.DefaultParams()}
+	s := &Service{
+		chains: map[uint64]*chainApp{1: {}, 10: {}},
+		profiles: newProfileStore(&profileSet{
+			profiles: map[string]*profileCircuit{
+				usdc.ID(): {profile: usdc, setup: &setup{}},
+				weth.ID(): {profile: weth, setup: &setup{}},
+				op.ID():   {profile: op, setup: &setup{}},
+			},
+			defaultProfile: usdc.ID(),
+			chainDefaults:  map[uint64]string{1: usdc.ID(), 10: op.ID()},
+		}),
+	}
+
+	withProfile := func(id string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs(ProfileMetadataKey, id))
+	}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		chainId uint64
+		want    string
+	}{
+		{"default", context.Background(), 0, usdc.ID()},
+		{"chain default", context.Background(), 10, op.ID()},
+		{"named", withProfile(weth.ID()), 1, weth.ID()},
+		{"unknown", withProfile("weth-usdc-v1"), 0, ""},
+		{"wrong chain", withProfile(weth.ID()), 10, ""},
+		{"unserved chain", context.Background(), 137, ""},
+	}
+	for _, tt := range tests {
+		pc, protoErr := s.resolveProfile(tt.ctx, &sdkproto.ProveRequest{SrcChainId: tt.chainId})
+		if tt.want == "" {
+			if protoErr == nil || protoErr.Code != sdkproto.ErrCode_ERROR_INVALID_INPUT {
+				t.Errorf("%s: expected invalid input error, got %v", tt.name, protoErr)
+			}
+			continue
+		}
+		if protoErr != nil {
+			t.Errorf("%s: unexpected error %s", tt.name, protoErr.Msg)
+			continue
+		}
+		if pc.profile.ID() != tt.want {
+			t.Errorf("%s: got profile %s, want %s", tt.name, pc.profile.ID(), tt.want)
+		}
+	}
+}
+
+func TestSetDefaultProfile(t *testing.T) {
+	usdc := circuits.DefaultProfile()
+	weth := circuits.Profile{Name: "weth-usdc", Version: 1, ChainId: 1, Params: circuits.DefaultParams()}
+	op := circuits.Profile{Name: "op-usdc", Version: 1, ChainId: 10, Params: circuits.DefaultParams()}
+	op2 := circuits.Profile{Name: "op-usdc", Version: 2, ChainId: 10, Params: circuits.DefaultParams()}
+	var pcs []*profileCircuit
+	for _, p := range []circuits.Profile{usdc, weth, op, op2} {
+		pcs = append(pcs, &profileCircuit{profile: p, setup: &setup{}})
+	}
+	ps, err := restoreProfiles(storedProfiles{}, pcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{config: Config{SetupDir: t.TempDir()}, profiles: newProfileStore(ps)}
+
+	check := func(step, def string, chainDefaults map[uint64]string) {
+		t.Helper()
+		ps := s.profiles.load()
+		if ps.defaultProfile != def {
+			t.Errorf("%s: default is %s, want %s", step, ps.defaultProfile, def)
+		}
+		for chainId, want := range chainDefaults {
+			if got := ps.chainDefaults[chainId]; got != want {
+				t.Errorf("%s: chain %d default is %s, want %s", step, chainId, got, want)
+			}
+		}
+	}
+
+	check("restored", usdc.ID(), map[uint64]string{1: usdc.ID(), 10: op.ID()})
+
+	// A chain default on another chain leaves the default alone
+	if err := s.SetDefaultProfile(op2.ID()); err != nil {
+		t.Fatal(err)
+	}
+	check("other chain", usdc.ID(), map[uint64]string{1: usdc.ID(), 10: op2.ID()})
+
+	if err := s.SetDefaultProfile(weth.ID()); err != nil {
+		t.Fatal(err)
+	}
+	check("same chain", weth.ID(), map[uint64]string{1: weth.ID(), 10: op2.ID()})
+
+	stored, err := readProfiles(s.profilesPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Default != weth.ID() || stored.ChainDefaults[10] != op2.ID() || stored.Revision != 3 {
+		t.Errorf("stored defaults %s and %v at revision %d", stored.Default, stored.ChainDefaults, stored.Revision)
+	}
+}
+
+func TestRestoreProfiles(t *testing.T) {
+	usdc := circuits.DefaultProfile()
+	weth := circuits.Profile{Name: "weth-usdc", Version: 1, ChainId: 1, Params: circuits.DefaultParams()}
+	op := circuits.Profile{Name: "op-usdc", Version: 1, ChainId: 10, Params: circuits.DefaultParams()}
+	setUp := func(profiles ...circuits.Profile) []*profileCircuit {
+		var pcs []*profileCircuit
+		for _, p := range profiles {
+			pcs = append(pcs, &profileCircuit{profile: p, setup: &setup{}})
+		}
+		return pcs
+	}
+
+	// Restoring the profiles stored at the last shutdown keeps their revision
+	ps, err := restoreProfiles(storedProfiles{}, setUp(usdc, weth, op))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ps.revision != 1 || ps.defaultProfile != usdc.ID() {
+		t.Fatalf("restored default %s at revision %d", ps.defaultProfile, ps.revision)
+	}
+	stored := ps.stored()
+	stored.Default, stored.ChainDefaults[1], stored.Revision = weth.ID(), weth.ID(), 5
+	data, err := json.Marshal(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(data, &stored); err != nil {
+		t.Fatal(err)
+	}
+	ps, err = restoreProfiles(stored, setUp(usdc, weth, op))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ps.revision != 5 || ps.defaultProfile != weth.ID() || ps.chainDefaults[1] != weth.ID() || ps.chainDefaults[10] != op.ID() {
+		t.Errorf("restored default %s and %v at revision %d", ps.defaultProfile, ps.chainDefaults, ps.revision)
+	}
+
+	// A profile added to the configuration is a new revision
+	op2 := circuits.Profile{Name: "op-usdc", Version: 2, ChainId: 10, Params: circuits.DefaultParams()}
+	ps, err = restoreProfiles(stored, setUp(usdc, weth, op, op2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ps.revision != 6 || ps.chainDefaults[10] != op.ID() {
+		t.Errorf("restored chain defaults %v at revision %d", ps.chainDefaults, ps.revision)
+	}
+
+	// Stored defaults must be restored profiles
+	if _, err = restoreProfiles(stored, setUp(usdc, op)); !errors.Is(err, ErrUnknownProfile) {
+		t.Errorf("got %v, want an unknown profile error", err)
+	}
+	stored.Default, stored.ChainDefaults[10] = usdc.ID(), weth.ID()
+	if _, err = restoreProfiles(stored, setUp(usdc, weth, op)); err == nil {
+		t.Error("expected an error for a chain default of another chain")
+	}
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"prover/internal/metrics"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/brevis-network/brevis-sdk/sdk/proto/sdkproto"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Prove builds the circuit input for the request and proves it synchronously,
+// unless the request was proven before
+func (s *Service) Prove(ctx context.Context, req *sdkproto.ProveRequest) (*sdkproto.ProveResponse, error) {
+	fmt.Println(req.String())
+	s.proving.Add(1)
+	defer s.proving.Done()
+
+	var profile string
+	errRes := func(protoErr *sdkproto.Err) (*sdkproto.ProveResponse, error) {
+		countFailure(profile, protoErr.Code)
+		return &sdkproto.ProveResponse{Err: protoErr, CircuitInfo: nil}, nil
+	}
+
+	pc, protoErr := s.resolveProfile(ctx, req)
+	profile = countRequest(pc)
+	if protoErr != nil {
+		return errRes(protoErr)
+	}
+	key, proof, info := s.lookupProof(pc, req)
+	if info != nil {
+		countSuccess(profile)
+		return &sdkproto.ProveResponse{Proof: proof, CircuitInfo: info}, nil
+	}
+	circuit, st := pc.circuit, pc.setup
+	input, guest, witness, protoErr := s.buildInput(req, circuit, s.chains[pc.profile.ChainId])
+	if protoErr != nil {
+		return errRes(protoErr)
+	}
+
+	proof, err := s.prove(profile, st, input, guest)
+	if err != nil {
+		return errRes(newErr(sdkproto.ErrCode_ERROR_FAILED_TO_PROVE, "failed to prove: %s", err.Error()))
+	}
+	info = buildAppCircuitInfo(circuit, *input, st.vkString, st.vkHash, witness)
+	s.cacheProof(key, proof, info)
+	countSuccess(profile)
+
+	return &sdkproto.ProveResponse{
+		Proof:       proof,
+		CircuitInfo: info,
+	}, nil
+}
+
+// ProveAsync builds the circuit input for the request and queues it as a job.
+// The proof can be fetched with GetProof using the returned id, which is the
+// job id.
+func (s *Service) ProveAsync(ctx context.Context, req *sdkproto.ProveRequest) (*sdkproto.ProveAsyncResponse, error) {
+	var profile string
+	errRes := func(protoErr *sdkproto.Err) (*sdkproto.ProveAsyncResponse, error) {
+		countFailure(profile, protoErr.Code)
+		return &sdkproto.ProveAsyncResponse{Err: protoErr, ProofId: "", CircuitInfo: nil}, nil
+	}
+
+	pc, protoErr := s.resolveProfile(ctx, req)
+	profile = countRequest(pc)
+	if protoErr != nil {
+		return errRes(protoErr)
+	}
+	j, protoErr := s.submitJob(pc, req)
+	if protoErr != nil {
+		return errRes(protoErr)
+	}
+
+	return &sdkproto.ProveAsyncResponse{
+		ProofId:     j.ID,
+		CircuitInfo: j.info,
+	}, nil
+}
+
+// GetProof returns the proof of an earlier ProveAsync request. The proof is
+// empty while the job is still queued or proving.
+func (s *Service) GetProof(ctx context.Context, req *sdkproto.GetProofRequest) (*sdkproto.GetProofResponse, error) {
+	id := req.ProofId
+	j, protoErr := s.jobs.get(id)
+	if protoErr != nil {
+		return &sdkproto.GetProofResponse{Err: protoErr}, nil
+	}
+
+	if j.Status == JobFailed {
+		return &sdkproto.GetProofResponse{
+			Err: newErr(sdkproto.ErrCode_ERROR_FAILED_TO_PROVE, "failed to prove: %s %s", id, j.Error),
+		}, nil
+	}
+
+	return &sdkproto.GetProofResponse{
+		Proof: j.Proof,
+	}, nil
+}
+
+func (s *Service) buildInput(req *sdkproto.ProveRequest, circuit sdk.AppCircuit, chain *chainApp) (*sdk.CircuitInput, sdk.AppCircuit, string, *sdkproto.Err) {
+	makeErr := func(code sdkproto.ErrCode, format string, args ...any) (*sdk.CircuitInput, sdk.AppCircuit, string, *sdkproto.Err) {
+		fmt.Printf(format, args...)
+		fmt.Println()
+		return nil, nil, "", newErr(code, format, args...)
+	}
+
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+
+	chain.app.ResetInput()
+
+	for _, receipt := range req.Receipts {
+		sdkReceipt, err := convertProtoReceiptToSdkReceipt(receipt.Data)
+		if err != nil {
+			return makeErr(sdkproto.ErrCode_ERROR_INVALID_INPUT, "invalid sdk receipt: %+v, %s", receipt.Data, err.Error())
+		}
+		chain.app.AddReceipt(sdkReceipt, int(receipt.Index))
+	}
+
+	for _, storage := range req.Storages {
+		sdkStorage, err := convertProtoStorageToSdkStorage(storage.Data)
+		if err != nil {
+			return makeErr(sdkproto.ErrCode_ERROR_INVALID_INPUT, "invalid sdk storage: %+v, %s", storage.Data, err.Error())
+		}
+		chain.app.AddStorage(sdkStorage, int(storage.Index))
+	}
+
+	for _, transaction := range req.Transactions {
+		sdkTx, err := convertProtoTxToSdkTx(transaction.Data)
+		if err != nil {
+			return makeErr(sdkproto.ErrCode_ERROR_INVALID_INPUT, "invalid sdk transaction: %+v, %s", transaction.Data, err.Error())
+		}
+		chain.app.AddTransaction(sdkTx, int(transaction.Index))
+	}
+
+	guest, err := assignCustomInput(circuit, req.CustomInput)
+	if err != nil {
+		return makeErr(sdkproto.ErrCode_ERROR_INVALID_CUSTOM_INPUT, "invalid custom input %s", err.Error())
+	}
+
+	input, err := chain.app.BuildCircuitInput(guest)
+	if err != nil {
+		return makeErr(sdkproto.ErrCode_ERROR_FAILED_TO_PROVE, "failed to build circuit input: %+v, %s", req, err.Error())
+	}
+
+	_, publicWitness, err := sdk.NewFullWitness(guest, input)
+	if err != nil {
+		return makeErr(sdkproto.ErrCode_ERROR_DEFAULT, "failed to prepare witness %s", err.Error())
+	}
+
+	var witnessBuffer bytes.Buffer
+	_, err = publicWitness.WriteTo(&witnessBuffer)
+	if err != nil {
+		return makeErr(sdkproto.ErrCode_ERROR_DEFAULT, "failed to convert witness %s", err.Error())
+	}
+	witness := fmt.Sprintf("0x%x", witnessBuffer.Bytes())
+
+	return &input, guest, witness, nil
+}
+
+func (s *Service) prove(profile string, st *setup, input *sdk.CircuitInput, guest sdk.AppCircuit) (string, error) {
+	witness, publicWitness, err := sdk.NewFullWitness(guest, *input)
+	if err != nil {
+		return "", fmt.Errorf("failed to get full witness: %s", err.Error())
+	}
+
+	s.proveSlots <- struct{}{}
+	metrics.ProofsInProgress.Inc()
+	start := time.Now()
+	proof, err := sdk.Prove(st.ccs, st.pk, witness)
+	metrics.ProvingDuration.WithLabelValues(profile).Observe(time.Since(start).Seconds())
+	metrics.ProofsInProgress.Dec()
+	<-s.proveSlots
+	if err != nil {
+		return "", fmt.Errorf("failed to prove: %s", err.Error())
+	}
+
+	err = sdk.Verify(st.vk, publicWitness, proof)
+	if err != nil {
+		return "", fmt.Errorf("failed to test verifying after proving: %s", err.Error())
+	}
+
+	var buf bytes.Buffer
+	_, err = proof.WriteRawTo(&buf)
+	if err != nil {
+		return "", fmt.Errorf("failed to write proof bytes: %s", err.Error())
+	}
+
+	return hexutil.Encode(buf.Bytes()), nil
+}
@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync"
+
+	"prover/circuits"
+	"prover/internal/metrics"
+
+	"github.com/brevis-network/brevis-sdk/sdk/proto/sdkproto"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/rs/cors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Service is a prover server compatible with the Brevis SDK prover API. Unlike
+// the SDK's prover.Service it serves several circuit profiles and source chains
+// at once, each profile with its own default custom inputs, and can add
+// profiles at runtime.
+type Service struct {
+	sdkproto.UnimplementedProverServer
+
+	config Config
+	// source chains by chain id, never modified after New
+	chains map[uint64]*chainApp
+
+	// profiles are the served profiles and their defaults
+	profiles *profileStore
+	// setups by circuit digest
+	setups map[string]*setup
+	// serializes setups so concurrent updates cannot interleave
+	setupLock sync.Mutex
+	// proveSlots bounds the number of proofs generated at once, since proving
+	// is memory hungry
+	proveSlots chan struct{}
+	// jobs are proven in the background, also for ProveAsync requests
+	jobs *jobQueue
+	// cache stores completed proofs, nil if the service caches none
+	cache *proofCache
+	// proving counts the workers and synchronous proofs, which write to the
+	// cache and the job journal
+	proving sync.WaitGroup
+
+	// serverLock guards the servers, which Serve starts and Shutdown stops
+	// from different goroutines
+	serverLock sync.Mutex
+	grpcServer *grpc.Server
+	restServer *http.Server
+	// shutdown keeps Serve from starting servers after Shutdown
+	shutdown bool
+}
+
+// New connects to the chains configured in config and sets up every profile
+// stored in its SetupDir. Chains without a stored profile start with their
+// profile in initial. If no default profile is stored yet, the first profile
+// is the default. Completed proofs are cached in SetupDir/proofs and jobs are
+// journaled in SetupDir/jobs. The service resumes the jobs unfinished at its
+// last shutdown and starts proving right away.
+func New(initial []circuits.Profile, config Config) (_ *Service, err error) {
+	if len(config.Chains) == 0 {
+		return nil, errors.New("no chains configured")
+	}
+	s := &Service{
+		config:     config,
+		chains:     make(map[uint64]*chainApp),
+		setups:     make(map[string]*setup),
+		proveSlots: make(chan struct{}, config.proveWorkers()),
+	}
+	for _, c := range config.Chains {
+		if s.servesChain(c.ChainId) {
+			return nil, fmt.Errorf("chain %d is configured twice", c.ChainId)
+		}
+		app, err := newChainApp(c, config.setupDir())
+		if err != nil {
+			return nil, err
+		}
+		s.chains[c.ChainId] = app
+	}
+
+	cache, err := openProofCache(filepath.Join(config.setupDir(), "proofs"))
+	if err != nil {
+		return nil, err
+	}
+	s.cache = cache
+	defer func() {
+		if err != nil {
+			s.closeStores()
+		}
+	}()
+	journal, err := openJobJournal(filepath.Join(config.setupDir(), "jobs"))
+	if err != nil {
+		return nil, err
+	}
+	s.jobs = newJobQueue(journal)
+
+	stored, err := readProfiles(s.profilesPath())
+	if err != nil {
+		return nil, err
+	}
+	profiles := stored.Profiles
+	for _, p := range initial {
+		if !stored.hasChain(p.ChainId) {
+			profiles = append(profiles, p)
+		}
+	}
+	if len(profiles) == 0 {
+		return nil, errors.New("no circuit profiles stored or configured")
+	}
+	pcs := make([]*profileCircuit, 0, len(profiles))
+	for _, p := range profiles {
+		pc, err := s.setupProfile(p)
+		if err != nil {
+			return nil, err
+		}
+		pcs = append(pcs, pc)
+	}
+	ps, err := restoreProfiles(stored, pcs)
+	if err != nil {
+		return nil, err
+	}
+	if ps.revision != stored.Revision {
+		if err = s.writeProfiles(ps); err != nil {
+			return nil, fmt.Errorf("failed to store profiles: %s", err.Error())
+		}
+	}
+	s.profiles = newProfileStore(ps)
+	for _, pc := range pcs {
+		setCircuitInfo(pc)
+	}
+	metrics.ProfileRevision.Set(float64(ps.revision))
+
+	if err = s.restoreJobs(); err != nil {
+		return nil, err
+	}
+	s.startWorkers(config.proveWorkers())
+	return s, nil
+}
+
+// Serve serves the prover GRPC API at port and its REST gateway at port+10,
+// with the GRPC server options, e.g. an interceptor authenticating callers. It
+// blocks until the service fails or is shut down.
+func (s *Service) Serve(bind string, port uint, opts ...grpc.ServerOption) error {
+	address := fmt.Sprintf("%s:%d", bind, port)
+	lis, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to start prover server: %s", err.Error())
+	}
+	grpcServer := grpc.NewServer(opts...)
+	sdkproto.RegisterProverServer(grpcServer, s)
+
+	mux := runtime.NewServeMux(runtime.WithIncomingHeaderMatcher(profileHeaderMatcher))
+	dialOpts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	err = sdkproto.RegisterProverHandlerFromEndpoint(context.Background(), mux, address, dialOpts)
+	if err != nil {
+		lis.Close()
+		return fmt.Errorf("failed to start prover server: %s", err.Error())
+	}
+	restServer := &http.Server{
+		Addr: fmt.Sprintf("%s:%d", bind, port+10),
+		Handler: cors.New(cors.Options{
+			AllowedHeaders:   []string{"*"},
+			AllowedOrigins:   []string{"*"},
+			AllowCredentials: true,
+		}).Handler(mux),
+	}
+
+	// publish the servers before serving, so a concurrent Shutdown either
+	// stops them or keeps them from starting
+	s.serverLock.Lock()
+	if s.shutdown {
+		s.serverLock.Unlock()
+		lis.Close()
+		return nil
+	}
+	s.grpcServer, s.restServer = grpcServer, restServer
+	s.serverLock.Unlock()
+
+	errs := make(chan error, 2)
+	go func() {
+		fmt.Println(">> serving prover GRPC at port", port)
+		errs <- grpcServer.Serve(lis)
+	}()
+	go func() {
+		fmt.Println(">> serving prover REST API at port", port+10)
+		err := restServer.ListenAndServe()
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		errs <- err
+	}()
+
+	return <-errs
+}
+
+// Shutdown stops accepting requests and waits for the ones in flight and the
+// proofs being proven until ctx is done. Requests still in flight then are
+// cancelled. Jobs still queued or proving are resumed by the next service.
+func (s *Service) Shutdown(ctx context.Context) error {
+	s.serverLock.Lock()
+	s.shutdown = true
+	grpcServer, restServer := s.grpcServer, s.restServer
+	s.serverLock.Unlock()
+
+	s.jobs.stop()
+	var err error
+	if restServer != nil {
+		err = restServer.Shutdown(ctx)
+	}
+	if grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcServer.Stop()
+		}
+	}
+
+	// proofs still being proven when ctx is done write to the cache and the
+	// journal, so these are left open for them
+	proven := make(chan struct{})
+	go func() {
+		s.proving.Wait()
+		close(proven)
+	}()
+	select {
+	case <-proven:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if closeErr := s.closeStores(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// closeStores closes the proof cache and the job journal
+func (s *Service) closeStores() error {
+	var err error
+	if s.cache != nil {
+		err = s.cache.close()
+	}
+	if s.jobs != nil && s.jobs.journal != nil {
+		if closeErr := s.jobs.journal.close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/brevis-network/brevis-sdk/sdk/proto/commonproto"
+)
+
+func freePort(t *testing.T) uint {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	return uint(lis.Addr().(*net.TCPAddr).Port)
+}
+
+func TestShutdownWhileServing(t *testing.T) {
+	// Shutdown racing with Serve stops the servers or keeps them from starting
+	for _, wait := range []time.Duration{0, 100 * time.Millisecond} {
+		s := &Service{jobs: newJobQueue(nil)}
+		served := make(chan error, 1)
+		go func() { served <- s.Serve("127.0.0.1", freePort(t)) }()
+		time.Sleep(wait)
+		if err := s.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-served:
+			if err != nil {
+				t.Errorf("serve failed: %s", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("still serving after shutdown")
+		}
+	}
+}
+
+func TestShutdownWaitsForProofs(t *testing.T) {
+	cache, err := openProofCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{jobs: newJobQueue(nil), cache: cache}
+
+	// A proof outlasting the shutdown keeps the cache open for it
+	s.proving.Add(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err = s.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want the deadline to be exceeded", err)
+	}
+	if err = cache.put("key", "0x01", &commonproto.AppCircuitInfo{}); err != nil {
+		t.Fatalf("cache closed while proving: %s", err)
+	}
+
+	// Otherwise the cache is closed once the proof is done
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		s.proving.Done()
+	}()
+	if err = s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err = cache.put("key", "0x01", &commonproto.AppCircuitInfo{}); err == nil {
+		t.Fatal("cache still open after shutdown")
+	}
+}
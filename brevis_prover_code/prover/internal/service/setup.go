@@ -0,0 +1,116 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/constraint"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// setup is the compiled circuit together with its proving and verifying keys
+type setup struct {
+	pk  plonk.ProvingKey
+	vk  plonk.VerifyingKey
+	ccs constraint.ConstraintSystem
+
+	digest   string
+	vkString string
+	vkHash   string
+}
+
+// setupCircuit compiles the circuit and returns its setup. Circuits compiling
+// to the same constraint system share one setup, so profiles that only differ
+// in their default custom inputs do not load the keys again.
+// Must be called with s.setupLock held or before the service is shared.
+func (s *Service) setupCircuit(circuit sdk.AppCircuit) (*setup, error) {
+	fmt.Println(">> compiling circuit")
+	ccs, err := sdk.CompileOnly(circuit)
+	if err != nil {
+		return nil, err
+	}
+
+	ccsBytes := bytes.NewBuffer(nil)
+	_, err = ccs.WriteTo(ccsBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	ccsDigest := crypto.Keccak256(ccsBytes.Bytes())
+	digest := fmt.Sprintf("0x%x", ccsDigest)
+	fmt.Println("circuit digest", digest)
+
+	if st, ok := s.setups[digest]; ok {
+		return st, nil
+	}
+	st, err := readOrSetup(circuit, ccs, digest, s.config.setupDir(), s.config.srsDir())
+	if err != nil {
+		return nil, err
+	}
+	s.setups[digest] = st
+	return st, nil
+}
+
+// readOrSetup loads the keys of the compiled circuit from setupDir, running a
+// new trusted setup only if no keys matching the circuit digest are stored yet
+func readOrSetup(circuit sdk.AppCircuit, ccs constraint.ConstraintSystem, digest, setupDir, srsDir string) (*setup, error) {
+	maxReceipts, maxStorage, maxTxs := circuit.Allocate()
+	dataPoints := sdk.DataPointsNextPowerOf2(maxReceipts + maxStorage + maxTxs)
+
+	pkFilepath := filepath.Join(setupDir, digest, "pk")
+	vkFilepath := filepath.Join(setupDir, digest, "vk")
+
+	fmt.Println("trying to read setup from cache...")
+	var err error
+	pk, vk, vkHash, found := readSetup(pkFilepath, vkFilepath, maxReceipts, maxStorage, dataPoints)
+	if !found {
+		fmt.Printf("no setup matching circuit digest %s is found in %s\n", digest, setupDir)
+		fmt.Println(">> setup")
+
+		pk, vk, vkHash, err = sdk.Setup(ccs, srsDir, maxReceipts, maxStorage, dataPoints)
+		if err != nil {
+			return nil, err
+		}
+		err = sdk.WriteTo(pk, pkFilepath)
+		if err != nil {
+			return nil, err
+		}
+		err = sdk.WriteTo(vk, vkFilepath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	_, err = vk.WriteRawTo(&buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode vk: %s", err.Error())
+	}
+
+	return &setup{
+		pk:       pk,
+		vk:       vk,
+		ccs:      ccs,
+		digest:   digest,
+		vkString: hexutil.Encode(buf.Bytes()),
+		vkHash:   hexutil.Encode(vkHash),
+	}, nil
+}
+
+func readSetup(pkFilepath, vkFilepath string, maxReceipt, maxStorage, numMaxDataPoints int) (pk plonk.ProvingKey, vk plonk.VerifyingKey, vkHash []byte, ok bool) {
+	var err error
+	pk, err = sdk.ReadPkFrom(pkFilepath)
+	if err != nil {
+		return
+	}
+	vk, vkHash, err = sdk.ReadVkFrom(vkFilepath, maxReceipt, maxStorage, numMaxDataPoints)
+	if err != nil {
+		return
+	}
+	ok = true
+	return
+}
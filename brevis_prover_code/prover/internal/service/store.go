@@ -0,0 +1,209 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"prover/internal/metrics"
+)
+
+// AnyRevision makes an update apply to whichever revision of the profiles is
+// current
+const AnyRevision = 0
+
+// ErrRevisionMismatch is returned by updates of a revision of the profiles
+// that is no longer current
+var ErrRevisionMismatch = errors.New("profiles changed")
+
+func revisionMismatch(revision, current uint64) error {
+	return fmt.Errorf("%w: revision %d is outdated, the profiles are at revision %d", ErrRevisionMismatch, revision, current)
+}
+
+// profileSet is a snapshot of the served profiles. It is never modified once
+// published, so it can be read without locking.
+type profileSet struct {
+	revision uint64
+	profiles map[string]*profileCircuit
+	// defaultProfile proves requests that name neither a profile nor a chain,
+	// chainDefaults the requests for a chain that do not name a profile
+	defaultProfile string
+	chainDefaults  map[uint64]string
+}
+
+func (ps *profileSet) clone() *profileSet {
+	next := &profileSet{
+		revision:       ps.revision,
+		profiles:       make(map[string]*profileCircuit, len(ps.profiles)),
+		defaultProfile: ps.defaultProfile,
+		chainDefaults:  make(map[uint64]string, len(ps.chainDefaults)),
+	}
+	for id, pc := range ps.profiles {
+		next.profiles[id] = pc
+	}
+	for chainId, id := range ps.chainDefaults {
+		next.chainDefaults[chainId] = id
+	}
+	return next
+}
+
+// add adds a profile that is not served yet
+func (ps *profileSet) add(pc *profileCircuit) error {
+	if _, ok := ps.profiles[pc.profile.ID()]; ok {
+		return fmt.Errorf("profile %s already exists", pc.profile.ID())
+	}
+	ps.profiles[pc.profile.ID()] = pc
+	return nil
+}
+
+// setDefault makes the profile the default of its chain. If the previous
+// default of the chain was also the default for requests without a chain,
+// the profile replaces it there too.
+func (ps *profileSet) setDefault(pc *profileCircuit) {
+	chainId := pc.profile.ChainId
+	if current, ok := ps.profiles[ps.defaultProfile]; !ok || current.profile.ChainId == chainId {
+		ps.defaultProfile = pc.profile.ID()
+	}
+	ps.chainDefaults[chainId] = pc.profile.ID()
+}
+
+func (ps *profileSet) latestVersion(name string) int {
+	version := 0
+	for _, pc := range ps.profiles {
+		if pc.profile.Name == name && pc.profile.Version > version {
+			version = pc.profile.Version
+		}
+	}
+	return version
+}
+
+func (ps *profileSet) info(pc *profileCircuit) ProfileInfo {
+	return ProfileInfo{
+		Profile: pc.profile,
+		ID:      pc.profile.ID(),
+		VkHash:  pc.setup.vkHash,
+		Default: pc.profile.ID() == ps.defaultProfile,
+
+		ChainDefault: pc.profile.ID() == ps.chainDefaults[pc.profile.ChainId],
+		Revision:     ps.revision,
+	}
+}
+
+// ProfileSnapshot is the state of the served profiles at a revision. The
+// revision grows with every change, also across restarts.
+type ProfileSnapshot struct {
+	Revision uint64
+	// Default is the id of the profile proving requests that name neither a
+	// profile nor a chain
+	Default string
+	// Profiles are ordered by id
+	Profiles []ProfileInfo
+}
+
+// Profile returns the profile with the id
+func (snapshot ProfileSnapshot) Profile(id string) (ProfileInfo, bool) {
+	for _, info := range snapshot.Profiles {
+		if info.ID == id {
+			return info, true
+		}
+	}
+	return ProfileInfo{}, false
+}
+
+// Latest returns the highest version of the named profile
+func (snapshot ProfileSnapshot) Latest(name string) (ProfileInfo, bool) {
+	var latest ProfileInfo
+	for _, info := range snapshot.Profiles {
+		if info.Name == name && info.Version > latest.Version {
+			latest = info
+		}
+	}
+	return latest, latest.Version > 0
+}
+
+func (ps *profileSet) snapshot() ProfileSnapshot {
+	snapshot := ProfileSnapshot{
+		Revision: ps.revision,
+		Default:  ps.defaultProfile,
+		Profiles: make([]ProfileInfo, 0, len(ps.profiles)),
+	}
+	for _, pc := range ps.profiles {
+		snapshot.Profiles = append(snapshot.Profiles, ps.info(pc))
+	}
+	sort.Slice(snapshot.Profiles, func(i, j int) bool { return snapshot.Profiles[i].ID < snapshot.Profiles[j].ID })
+	return snapshot
+}
+
+// profileStore holds the served profiles. Readers load the current snapshot
+// without locking. Writers are serialized, change a copy of the snapshot and
+// publish it as the next revision.
+type profileStore struct {
+	current atomic.Pointer[profileSet]
+	lock    sync.Mutex
+	// subscribers receive the latest snapshot after every change
+	subscribers map[chan ProfileSnapshot]struct{}
+}
+
+func newProfileStore(ps *profileSet) *profileStore {
+	st := &profileStore{subscribers: make(map[chan ProfileSnapshot]struct{})}
+	st.current.Store(ps)
+	return st
+}
+
+func (st *profileStore) load() *profileSet {
+	return st.current.Load()
+}
+
+// update applies change to a copy of the current profiles and publishes it as
+// the next revision. Nothing is published if change fails, or if revision is
+// not AnyRevision and no longer current.
+func (st *profileStore) update(revision uint64, change func(ps *profileSet) error) (*profileSet, error) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	current := st.current.Load()
+	if revision != AnyRevision && revision != current.revision {
+		return nil, revisionMismatch(revision, current.revision)
+	}
+	next := current.clone()
+	next.revision++
+	if err := change(next); err != nil {
+		return nil, err
+	}
+	st.current.Store(next)
+	metrics.ProfileRevision.Set(float64(next.revision))
+
+	if len(st.subscribers) > 0 {
+		snapshot := next.snapshot()
+		for ch := range st.subscribers {
+			// replace a snapshot the subscriber has not received yet, so
+			// slow subscribers skip to the latest one instead of blocking
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- snapshot
+		}
+	}
+	return next, nil
+}
+
+// subscribe returns a channel receiving the snapshot after every change, and
+// a function ending the subscription and closing the channel
+func (st *profileStore) subscribe() (<-chan ProfileSnapshot, func()) {
+	ch := make(chan ProfileSnapshot, 1)
+	st.lock.Lock()
+	st.subscribers[ch] = struct{}{}
+	st.lock.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			st.lock.Lock()
+			defer st.lock.Unlock()
+			delete(st.subscribers, ch)
+			close(ch)
+		})
+	}
+}
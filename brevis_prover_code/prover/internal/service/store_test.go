@@ -0,0 +1,91 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"prover/circuits"
+)
+
+func TestProfileStoreUpdate(t *testing.T) {
+	usdc := circuits.DefaultProfile()
+	weth := circuits.Profile{Name: "weth-usdc", Version: 1, ChainId: 1, Params: circuits.DefaultParams()}
+	st := newProfileStore(&profileSet{revision: 7, profiles: map[string]*profileCircuit{}, chainDefaults: map[uint64]string{}})
+
+	changes, unsubscribe := st.subscribe()
+	ps, err := st.update(7, func(ps *profileSet) error {
+		pc := &profileCircuit{profile: usdc, setup: &setup{}}
+		if err := ps.add(pc); err != nil {
+			return err
+		}
+		ps.setDefault(pc)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ps.revision != 8 || st.load() != ps {
+		t.Errorf("published revision %d", st.load().revision)
+	}
+	if snapshot := <-changes; snapshot.Revision != 8 || snapshot.Default != usdc.ID() || len(snapshot.Profiles) != 1 {
+		t.Errorf("unexpected snapshot %+v", snapshot)
+	}
+
+	// Updates of an outdated revision and failed updates publish nothing
+	if _, err = st.update(7, func(*profileSet) error { return nil }); !errors.Is(err, ErrRevisionMismatch) {
+		t.Errorf("got %v, want a revision mismatch", err)
+	}
+	if _, err = st.update(AnyRevision, func(ps *profileSet) error {
+		return ps.add(&profileCircuit{profile: usdc, setup: &setup{}})
+	}); err == nil {
+		t.Error("added a profile twice")
+	}
+	if st.load() != ps {
+		t.Errorf("published revision %d", st.load().revision)
+	}
+
+	// A slow subscriber only receives the latest snapshot
+	for i := 0; i < 3; i++ {
+		if _, err = st.update(AnyRevision, func(*profileSet) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if snapshot := <-changes; snapshot.Revision != 11 {
+		t.Errorf("got revision %d, want 11", snapshot.Revision)
+	}
+	unsubscribe()
+	unsubscribe()
+	if _, ok := <-changes; ok {
+		t.Error("channel not closed")
+	}
+
+	// Concurrent updates of the same revision all but one fail
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	applied := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := st.update(11, func(ps *profileSet) error {
+				ps.profiles = map[string]*profileCircuit{weth.ID(): {profile: weth, setup: &setup{}}}
+				return nil
+			})
+			if err == nil {
+				lock.Lock()
+				applied++
+				lock.Unlock()
+			}
+		}()
+		go func() { _ = st.load().snapshot() }()
+	}
+	wg.Wait()
+	if applied != 1 || st.load().revision != 12 {
+		t.Errorf("%d updates applied, at revision %d", applied, st.load().revision)
+	}
+	// Published snapshots are never changed
+	if _, ok := ps.profiles[weth.ID()]; ok || len(ps.profiles) != 1 {
+		t.Errorf("revision 8 changed to %v", ps.profiles)
+	}
+}
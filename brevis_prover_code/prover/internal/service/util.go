@@ -0,0 +1,111 @@
+package service
+
+import (
+	"fmt"
+	"math/big"
+
+	"prover/internal/metrics"
+
+	"github.com/brevis-network/brevis-sdk/sdk"
+	"github.com/brevis-network/brevis-sdk/sdk/proto/commonproto"
+	"github.com/brevis-network/brevis-sdk/sdk/proto/sdkproto"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+func buildAppCircuitInfo(app sdk.AppCircuit, in sdk.CircuitInput, vk, vkHash, witness string) *commonproto.AppCircuitInfo {
+	inputCommitments := make([]string, len(in.InputCommitments))
+	for i, value := range in.InputCommitments {
+		inputCommitments[i] = fmt.Sprintf("0x%x", value)
+	}
+
+	toggles := make([]bool, len(in.Toggles()))
+	for i, value := range in.Toggles() {
+		toggles[i] = fmt.Sprintf("%x", value) == "1"
+	}
+
+	maxReceipts, maxStorage, maxTxs := app.Allocate()
+	dataPoints := sdk.DataPointsNextPowerOf2(maxReceipts + maxStorage + maxTxs)
+
+	return &commonproto.AppCircuitInfo{
+		OutputCommitment:     hexutil.Encode(in.OutputCommitment.Hash().Bytes()),
+		Vk:                   vk,
+		InputCommitments:     inputCommitments,
+		Toggles:              toggles,
+		UseCallback:          true,
+		Output:               hexutil.Encode(in.GetAbiPackedOutput()),
+		VkHash:               vkHash,
+		InputCommitmentsRoot: fmt.Sprintf("0x%x", in.InputCommitmentsRoot),
+		Witness:              witness,
+		MaxReceipts:          uint32(maxReceipts),
+		MaxStorage:           uint32(maxStorage),
+		MaxTx:                uint32(maxTxs),
+		MaxNumDataPoints:     uint32(dataPoints),
+	}
+}
+
+func convertProtoReceiptToSdkReceipt(in *sdkproto.ReceiptData) (sdk.ReceiptData, error) {
+	if in == nil || len(in.Fields) == 0 {
+		return sdk.ReceiptData{}, fmt.Errorf("invalid log field")
+	}
+
+	fields := make([]sdk.LogFieldData, len(in.Fields))
+	for i, f := range in.Fields {
+		fields[i] = sdk.LogFieldData{
+			LogPos:     uint(f.LogPos),
+			IsTopic:    f.IsTopic,
+			FieldIndex: uint(f.FieldIndex),
+		}
+	}
+
+	return sdk.ReceiptData{
+		TxHash: common.HexToHash(in.TxHash),
+		Fields: fields,
+	}, nil
+}
+
+func convertProtoStorageToSdkStorage(in *sdkproto.StorageData) (sdk.StorageData, error) {
+	if in == nil {
+		return sdk.StorageData{}, fmt.Errorf("missing storage data")
+	}
+	return sdk.StorageData{
+		BlockNum: new(big.Int).SetUint64(in.BlockNum),
+		Address:  common.HexToAddress(in.Address),
+		Slot:     common.HexToHash(in.Slot),
+	}, nil
+}
+
+func convertProtoTxToSdkTx(in *sdkproto.TransactionData) (sdk.TransactionData, error) {
+	if in == nil {
+		return sdk.TransactionData{}, fmt.Errorf("missing transaction data")
+	}
+	return sdk.TransactionData{
+		Hash: common.HexToHash(in.Hash),
+	}, nil
+}
+
+// countRequest counts a proof request resolved to the profile, nil if it
+// could not be resolved, and returns the profile's metrics label
+func countRequest(pc *profileCircuit) string {
+	profile := ""
+	if pc != nil {
+		profile = pc.profile.ID()
+	}
+	metrics.ProofsRequested.WithLabelValues(profile).Inc()
+	return profile
+}
+
+func countSuccess(profile string) {
+	metrics.ProofsSucceeded.WithLabelValues(profile).Inc()
+}
+
+func countFailure(profile string, code sdkproto.ErrCode) {
+	metrics.ProofsFailed.WithLabelValues(profile, metrics.ErrorClass(code)).Inc()
+}
+
+func newErr(code sdkproto.ErrCode, format string, args ...any) *sdkproto.Err {
+	return &sdkproto.Err{
+		Code: code,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
@@ -2,9 +2,75 @@ package internal
 
 // CircuitParams represents the configurable parameters for the circuit
 type CircuitParams struct {
+	Profile string `json:"profile,omitempty"`
+	Kind    string `json:"kind,omitempty"`
+	ChainId uint64 `json:"chain_id,omitempty"`
+	// Chain names the chain instead of ChainId, e.g. base
+	Chain string `json:"chain,omitempty"`
+	// Pair names the tokens by symbol instead of their addresses, e.g.
+	// USDC/WETH. It also sets their decimals and the pool of the token
+	// registry pricing them.
+	Pair          string `json:"pair,omitempty"`
 	Token1Address string `json:"token1_address"`
 	Token2Address string `json:"token2_address"`
 	MinimumVolume string `json:"minimum_volume,omitempty"`
+	// Token decimals, nil to keep the current ones or, for a token changed
+	// by address, to look them up in the token registry
+	Token1Decimals *uint8 `json:"token1_decimals,omitempty"`
+	Token2Decimals *uint8 `json:"token2_decimals,omitempty"`
+	// Uniswap v4 pool pricing token 2 in token 1. Changing a token drops the
+	// current pool unless a new one is set.
+	PoolManager string `json:"pool_manager,omitempty"`
+	PoolId      string `json:"pool_id,omitempty"`
+	// MakeDefault makes the new profile version the one used for proof
+	// requests that do not name a profile
+	MakeDefault bool `json:"make_default,omitempty"`
+	// DryRun validates the update and reports what it would change without
+	// creating the profile version
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// ProfileConfig describes a circuit profile served by the prover
+type ProfileConfig struct {
+	ID      string        `json:"id"`
+	Name    string        `json:"name"`
+	Version int           `json:"version"`
+	Default bool          `json:"default"`
+	VkHash  string        `json:"vk_hash"`
+	Config  CircuitParams `json:"config"`
+	// ChainDefault is set if the profile proves requests for its chain that
+	// do not name a profile
+	ChainDefault bool `json:"chain_default"`
+	// Token1 and Token2 describe the profile's tokens. MinimumVolume is the
+	// minimum transfer amount in the smallest unit and in tokens of token 1.
+	Token1        *TokenInfo `json:"token1,omitempty"`
+	Token2        *TokenInfo `json:"token2,omitempty"`
+	MinimumVolume *Amount    `json:"minimum_volume,omitempty"`
+}
+
+// TokenInfo describes a token of a profile. The symbol is empty if the token
+// registry does not know the token. The decimals are the profile's.
+type TokenInfo struct {
+	Address  string `json:"address"`
+	Symbol   string `json:"symbol,omitempty"`
+	Decimals uint8  `json:"decimals"`
+}
+
+// Amount is a token amount in the token's smallest unit and as a decimal
+// number of tokens, e.g. 500000000 and 500 USDC
+type Amount struct {
+	Raw     string `json:"raw"`
+	Decimal string `json:"decimal"`
+	Symbol  string `json:"symbol,omitempty"`
+}
+
+// HookDataRequest asks for the hookData of a proof for one of the hooks
+type HookDataRequest struct {
+	// Hook is the name of the hook, e.g. BrevisVerificationHook
+	Hook string `json:"hook"`
+	// Proof and Output are the hex encoded proof and packed circuit output
+	Proof  string `json:"proof"`
+	Output string `json:"output"`
 }
 
 // Response represents the API response
@@ -12,4 +78,6 @@ type Response struct {
 	Success bool   `json:"success"`
 	Message string `json:"message,omitempty"`
 	Error   string `json:"error,omitempty"`
+	// Fields are the invalid fields of a rejected request
+	Fields []FieldError `json:"fields,omitempty"`
 }
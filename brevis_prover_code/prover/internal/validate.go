@@ -0,0 +1,202 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"prover/circuits"
+	"prover/tokens"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	hexAddress = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+	hexHash    = regexp.MustCompile(`^0x[0-9a-fA-F]{64}$`)
+)
+
+// FieldError reports why a request field is invalid
+type FieldError struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+// Change is a parameter a profile update changes
+type Change struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// apply returns p with the parameters set in params, or the problem of every
+// invalid field. Chains and pairs named in params are resolved with the
+// registry, and so are the decimals of tokens params changes by address.
+func (params CircuitParams) apply(ctx context.Context, p circuits.Profile, registry *tokens.Registry) (circuits.Profile, []FieldError) {
+	var errs []FieldError
+	fail := func(field, format string, args ...any) {
+		errs = append(errs, FieldError{Field: field, Error: fmt.Sprintf(format, args...)})
+	}
+	address := func(field, v string, addr *common.Address) {
+		if v == "" {
+			return
+		}
+		if err := checkAddress(v); err != nil {
+			fail(field, "%s", err.Error())
+			return
+		}
+		*addr = common.HexToAddress(v)
+	}
+
+	p.Name = params.Profile
+	switch params.Kind {
+	case "":
+	case circuits.KindPair, circuits.KindAggregate, circuits.KindTradingVolume, circuits.KindVolatility:
+		p.Kind = params.Kind
+	default:
+		fail("kind", "unknown kind %q, expected pair, aggregate, trading_volume or volatility", params.Kind)
+	}
+	if params.ChainId != 0 {
+		p.ChainId = params.ChainId
+	}
+	if params.Chain != "" {
+		chainId, err := registry.ChainID(params.Chain)
+		switch {
+		case err != nil:
+			fail("chain", "%s", err.Error())
+		case params.ChainId != 0 && params.ChainId != chainId:
+			fail("chain", "%s is chain %d, but chain_id is %d", params.Chain, chainId, params.ChainId)
+		default:
+			p.ChainId = chainId
+		}
+	}
+
+	// A pair sets the tokens, their decimals and pricing pool, which the
+	// other fields may override
+	if params.Pair != "" {
+		if params.Token1Address != "" || params.Token2Address != "" {
+			fail("pair", "cannot be combined with token1_address or token2_address")
+		} else if pair, err := registry.Pair(p.ChainId, params.Pair); err != nil {
+			fail("pair", "%s", err.Error())
+		} else {
+			p.Params = circuits.PairParams(pair, p.Params.MinVolume)
+		}
+	}
+	token1, token2 := p.Params.Token1Addr, p.Params.Token2Addr
+	address("token1_address", params.Token1Address, &p.Params.Token1Addr)
+	address("token2_address", params.Token2Address, &p.Params.Token2Addr)
+
+	// A token changed by address takes its decimals from the registry unless
+	// they are set, and the pool priced the old tokens, so it is dropped
+	// unless a new one is set
+	tokenChanged := false
+	resolveDecimals := func(field string, old, addr common.Address, decimals *uint8, set bool) {
+		if addr == old {
+			return
+		}
+		tokenChanged = true
+		if set || addr == (common.Address{}) {
+			return
+		}
+		if token, err := registry.Token(ctx, p.ChainId, addr); err == nil {
+			*decimals = token.Decimals
+		} else {
+			fail(field, "required for %s, which the token registry does not know", addr.Hex())
+		}
+	}
+	resolveDecimals("token1_decimals", token1, p.Params.Token1Addr, &p.Params.Token1Decimals, params.Token1Decimals != nil)
+	resolveDecimals("token2_decimals", token2, p.Params.Token2Addr, &p.Params.Token2Decimals, params.Token2Decimals != nil)
+	if tokenChanged {
+		p.Params.PoolManager = common.Address{}
+		p.Params.PoolId = common.Hash{}
+	}
+
+	if params.MinimumVolume != "" {
+		volume, ok := new(big.Int).SetString(params.MinimumVolume, 10)
+		switch {
+		case !ok:
+			fail("minimum_volume", "%q is not a decimal integer", params.MinimumVolume)
+		case volume.Sign() < 0:
+			fail("minimum_volume", "must not be negative")
+		case volume.Cmp(circuits.MaxUint248) > 0:
+			fail("minimum_volume", "must be below 2^248")
+		default:
+			p.Params.MinVolume = volume
+		}
+	}
+	if params.Token1Decimals != nil {
+		p.Params.Token1Decimals = *params.Token1Decimals
+	}
+	if params.Token2Decimals != nil {
+		p.Params.Token2Decimals = *params.Token2Decimals
+	}
+	if p.Params.Token1Decimals > circuits.NormalizedDecimals {
+		fail("token1_decimals", "must be at most %d", circuits.NormalizedDecimals)
+	}
+	if p.Params.Token2Decimals > circuits.NormalizedDecimals {
+		fail("token2_decimals", "must be at most %d", circuits.NormalizedDecimals)
+	}
+	address("pool_manager", params.PoolManager, &p.Params.PoolManager)
+	if params.PoolId != "" {
+		if hexHash.MatchString(params.PoolId) {
+			p.Params.PoolId = common.HexToHash(params.PoolId)
+		} else {
+			fail("pool_id", "%q is not a 32 byte hex string", params.PoolId)
+		}
+	}
+
+	if len(errs) == 0 && p.Params.Token1Addr == (common.Address{}) {
+		fail("token1_address", "must not be the zero address")
+	}
+	if len(errs) == 0 && p.Kind != circuits.KindTradingVolume && p.Params.Token1Addr == p.Params.Token2Addr {
+		fail("token2_address", "must differ from token1_address %s", p.Params.Token1Addr.Hex())
+	}
+	return p, errs
+}
+
+// checkAddress checks that v is a hex encoded address. Mixed case addresses
+// must have a valid EIP-55 checksum.
+func checkAddress(v string) error {
+	if !hexAddress.MatchString(v) {
+		return fmt.Errorf("%q is not a 20 byte hex address", v)
+	}
+	digits := v[2:]
+	if digits == strings.ToLower(digits) || digits == strings.ToUpper(digits) {
+		return nil
+	}
+	if checksummed := common.HexToAddress(v).Hex(); checksummed != v {
+		return fmt.Errorf("%q has an invalid EIP-55 checksum, expected %s", v, checksummed)
+	}
+	return nil
+}
+
+// changes returns the parameters that differ between old and new, ordered by
+// field name
+func changes(old, new CircuitParams) []Change {
+	oldFields, newFields := fieldValues(old), fieldValues(new)
+	changed := []Change{}
+	for field, value := range newFields {
+		if !reflect.DeepEqual(oldFields[field], value) {
+			changed = append(changed, Change{Field: field, Old: oldFields[field], New: value})
+		}
+	}
+	for field, value := range oldFields {
+		if _, ok := newFields[field]; !ok {
+			changed = append(changed, Change{Field: field, Old: value})
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].Field < changed[j].Field })
+	return changed
+}
+
+func fieldValues(params CircuitParams) map[string]interface{} {
+	data, _ := json.Marshal(params)
+	var fields map[string]interface{}
+	_ = json.Unmarshal(data, &fields)
+	return fields
+}
@@ -0,0 +1,156 @@
+package internal
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"prover/circuits"
+	"prover/tokens"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	usdc = "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"
+	usdt = "0xdAC17F958D2ee523a2206206994597C13D831ec7"
+)
+
+func TestApplyCircuitParams(t *testing.T) {
+	registry, err := tokens.Load("../configs/tokens.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := circuits.Profile{Name: "usdc-usdt", Kind: circuits.KindPair, ChainId: 1}
+	base.Params.Token1Addr = common.HexToAddress(usdc)
+	base.Params.Token2Addr = common.HexToAddress(usdt)
+	base.Params.MinVolume = big.NewInt(1)
+
+	tooLarge := new(big.Int).Lsh(big.NewInt(1), 248).String()
+	tests := []struct {
+		name   string
+		params CircuitParams
+		field  string
+	}{
+		{"valid", CircuitParams{Token1Address: usdc, Token2Address: usdt, MinimumVolume: circuits.MaxUint248.String()}, ""},
+		{"lower case", CircuitParams{Token2Address: "0xdac17f958d2ee523a2206206994597c13d831ec7"}, ""},
+		{"short address", CircuitParams{Token1Address: "0xa0b8"}, "token1_address"},
+		{"bad checksum", CircuitParams{Token1Address: "0xa0B86991c6218b36c1d19D4a2e9Eb0cE3606eB48"}, "token1_address"},
+		{"zero token", CircuitParams{Token1Address: "0x0000000000000000000000000000000000000000"}, "token1_address"},
+		{"same tokens", CircuitParams{Token2Address: usdc}, "token2_address"},
+		{"volume too large", CircuitParams{MinimumVolume: tooLarge}, "minimum_volume"},
+		{"negative volume", CircuitParams{MinimumVolume: "-1"}, "minimum_volume"},
+		{"hex volume", CircuitParams{MinimumVolume: "0x10"}, "minimum_volume"},
+		{"unknown kind", CircuitParams{Kind: "swap"}, "kind"},
+		{"bad pool id", CircuitParams{PoolId: "0x1234"}, "pool_id"},
+	}
+	for _, tt := range tests {
+		p, errs := tt.params.apply(context.Background(), base, registry)
+		switch {
+		case tt.field == "" && len(errs) > 0:
+			t.Errorf("%s: unexpected errors %v", tt.name, errs)
+		case tt.field != "" && (len(errs) != 1 || errs[0].Field != tt.field):
+			t.Errorf("%s: got errors %v, want one for %s", tt.name, errs, tt.field)
+		case tt.field == "" && tt.params.MinimumVolume != "" && p.Params.MinVolume.String() != tt.params.MinimumVolume:
+			t.Errorf("%s: got minimum volume %s", tt.name, p.Params.MinVolume)
+		}
+	}
+
+	// Trading volume circuits only track token 1
+	if _, errs := (CircuitParams{Kind: circuits.KindTradingVolume, Token2Address: usdc}).apply(context.Background(), base, registry); len(errs) > 0 {
+		t.Errorf("unexpected errors %v", errs)
+	}
+}
+
+func TestApplyPair(t *testing.T) {
+	registry, err := tokens.Load("../configs/tokens.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := circuits.DefaultProfile()
+
+	p, errs := CircuitParams{Chain: "base", Pair: "WETH/USDC"}.apply(context.Background(), base, registry)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if p.ChainId != 8453 || p.Params.Token1Decimals != 18 || p.Params.Token2Addr != common.HexToAddress("0x833589fCD6eDb6E08f4c7C32D4f71b54bdA02913") ||
+		p.Params.MinVolume.Cmp(base.Params.MinVolume) != 0 || p.Params.UsesPrice() {
+		t.Errorf("unexpected profile %+v", p)
+	}
+
+	// The registry knows a pool pricing USDT in USDC on Ethereum
+	p, errs = CircuitParams{Pair: "USDC/USDT", Token2Decimals: new(uint8)}.apply(context.Background(), base, registry)
+	if len(errs) > 0 || !p.Params.UsesPrice() || p.Params.PoolId != registry.Pools(1)[0].ID() || p.Params.Token2Decimals != 0 {
+		t.Errorf("unexpected profile %+v, %v", p, errs)
+	}
+
+	for field, params := range map[string]CircuitParams{
+		"chain": {Chain: "base", ChainId: 10},
+		"pair":  {Pair: "USDC/WETH", Token1Address: usdc},
+	} {
+		if _, errs = params.apply(context.Background(), base, registry); len(errs) != 1 || errs[0].Field != field {
+			t.Errorf("got errors %v, want one for %s", errs, field)
+		}
+	}
+	if _, errs = (CircuitParams{Chain: "solana"}).apply(context.Background(), base, registry); len(errs) != 1 || errs[0].Field != "chain" {
+		t.Errorf("got errors %v", errs)
+	}
+	if _, errs = (CircuitParams{Chain: "optimism", Pair: "USDC/DAI"}).apply(context.Background(), base, registry); len(errs) != 1 || errs[0].Field != "pair" {
+		t.Errorf("got errors %v", errs)
+	}
+}
+
+func TestApplyTokenChange(t *testing.T) {
+	registry, err := tokens.Load("../configs/tokens.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	weth, err := registry.BySymbol(1, "WETH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// USDC/USDT priced by the pool of the registry
+	base, errs := CircuitParams{Pair: "USDC/USDT"}.apply(ctx, circuits.DefaultProfile(), registry)
+	if len(errs) > 0 || !base.Params.UsesPrice() {
+		t.Fatalf("unexpected profile %+v, %v", base, errs)
+	}
+
+	// The new token's decimals come from the registry and the USDC/USDT pool
+	// is dropped
+	p, errs := CircuitParams{Token2Address: weth.Address.Hex()}.apply(ctx, base, registry)
+	if len(errs) > 0 || p.Params.Token2Decimals != 18 || p.Params.Token1Decimals != 6 || p.Params.UsesPrice() || p.Params.PoolId != (common.Hash{}) {
+		t.Errorf("unexpected profile %+v, %v", p, errs)
+	}
+
+	// Tokens the registry does not know need their decimals
+	unknown := "0x1111111111111111111111111111111111111111"
+	if _, errs = (CircuitParams{Token1Address: unknown}).apply(ctx, base, registry); len(errs) != 1 || errs[0].Field != "token1_decimals" {
+		t.Errorf("got errors %v, want one for token1_decimals", errs)
+	}
+	decimals := uint8(8)
+	pool := "0x2222222222222222222222222222222222222222222222222222222222222222"
+	p, errs = CircuitParams{Token1Address: unknown, Token1Decimals: &decimals, PoolManager: base.Params.PoolManager.Hex(), PoolId: pool}.apply(ctx, base, registry)
+	if len(errs) > 0 || p.Params.Token1Decimals != 8 || p.Params.Token2Decimals != 6 || p.Params.PoolId != common.HexToHash(pool) || p.Params.PoolManager != base.Params.PoolManager {
+		t.Errorf("unexpected profile %+v, %v", p, errs)
+	}
+
+	// Unchanged tokens keep their decimals and pool
+	p, errs = CircuitParams{Token1Address: usdc, MinimumVolume: "1"}.apply(ctx, base, registry)
+	if len(errs) > 0 || p.Params.PoolId != base.Params.PoolId || p.Params.Token1Decimals != 6 {
+		t.Errorf("unexpected profile %+v, %v", p, errs)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	old := CircuitParams{Profile: "usdc-usdt", Token1Address: usdc, Token2Address: usdt, MinimumVolume: "1"}
+	updated := old
+	updated.MinimumVolume = "2"
+	updated.PoolId = "0x01"
+
+	got := changes(old, updated)
+	if len(got) != 2 || got[0].Field != "minimum_volume" || got[0].Old != "1" || got[0].New != "2" ||
+		got[1].Field != "pool_id" || got[1].Old != nil {
+		t.Errorf("unexpected changes %+v", got)
+	}
+}
@@ -0,0 +1,50 @@
+// Code generated by outputgen from the AggregatePnl circuit output schema. DO NOT EDIT.
+
+package outputs
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// AggregatePnlSize is the length of the packed AggregatePnl circuit output
+const AggregatePnlSize = 176
+
+// AggregatePnlOutput is the decoded AggregatePnl circuit output
+type AggregatePnlOutput struct {
+	Account        common.Address
+	TotalVolume    *big.Int
+	PnlAmount      *big.Int
+	IsProfit       bool
+	TradeCount     uint32
+	FirstBlock     uint64
+	LastBlock      uint64
+	Token1         common.Address
+	Token2         common.Address
+	MinVolume      *big.Int
+	Token1Decimals uint8
+	Token2Decimals uint8
+}
+
+// DecodeAggregatePnlOutput decodes the packed AggregatePnl circuit output
+func DecodeAggregatePnlOutput(b []byte) (*AggregatePnlOutput, error) {
+	if len(b) != AggregatePnlSize {
+		return nil, fmt.Errorf("invalid AggregatePnl output length %d, expected %d", len(b), AggregatePnlSize)
+	}
+	return &AggregatePnlOutput{
+		Account:        common.BytesToAddress(b[0:20]),
+		TotalVolume:    new(big.Int).SetBytes(b[20:51]),
+		PnlAmount:      new(big.Int).SetBytes(b[51:82]),
+		IsProfit:       new(big.Int).SetBytes(b[82:83]).Sign() != 0,
+		TradeCount:     uint32(new(big.Int).SetBytes(b[83:87]).Uint64()),
+		FirstBlock:     new(big.Int).SetBytes(b[87:95]).Uint64(),
+		LastBlock:      new(big.Int).SetBytes(b[95:103]).Uint64(),
+		Token1:         common.BytesToAddress(b[103:123]),
+		Token2:         common.BytesToAddress(b[123:143]),
+		MinVolume:      new(big.Int).SetBytes(b[143:174]),
+		Token1Decimals: uint8(new(big.Int).SetBytes(b[174:175]).Uint64()),
+		Token2Decimals: uint8(new(big.Int).SetBytes(b[175:176]).Uint64()),
+	}, nil
+}
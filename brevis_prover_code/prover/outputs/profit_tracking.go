@@ -0,0 +1,54 @@
+// Code generated by outputgen from the ProfitTracking circuit output schema. DO NOT EDIT.
+
+package outputs
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ProfitTrackingSize is the length of the packed ProfitTracking circuit output
+const ProfitTrackingSize = 221
+
+// ProfitTrackingOutput is the decoded ProfitTracking circuit output
+type ProfitTrackingOutput struct {
+	BuyBlockNum    uint64
+	SellBlockNum   uint64
+	Account        common.Address
+	PnlAmount      *big.Int
+	IsProfit       bool
+	Token1         common.Address
+	Token2         common.Address
+	MinVolume      *big.Int
+	Token1Decimals uint8
+	Token2Decimals uint8
+	PoolManager    common.Address
+	PoolId         common.Hash
+	SqrtPriceX96   *big.Int
+	SwapBlockNum   uint64
+}
+
+// DecodeProfitTrackingOutput decodes the packed ProfitTracking circuit output
+func DecodeProfitTrackingOutput(b []byte) (*ProfitTrackingOutput, error) {
+	if len(b) != ProfitTrackingSize {
+		return nil, fmt.Errorf("invalid ProfitTracking output length %d, expected %d", len(b), ProfitTrackingSize)
+	}
+	return &ProfitTrackingOutput{
+		BuyBlockNum:    new(big.Int).SetBytes(b[0:8]).Uint64(),
+		SellBlockNum:   new(big.Int).SetBytes(b[8:16]).Uint64(),
+		Account:        common.BytesToAddress(b[16:36]),
+		PnlAmount:      new(big.Int).SetBytes(b[36:67]),
+		IsProfit:       new(big.Int).SetBytes(b[67:68]).Sign() != 0,
+		Token1:         common.BytesToAddress(b[68:88]),
+		Token2:         common.BytesToAddress(b[88:108]),
+		MinVolume:      new(big.Int).SetBytes(b[108:139]),
+		Token1Decimals: uint8(new(big.Int).SetBytes(b[139:140]).Uint64()),
+		Token2Decimals: uint8(new(big.Int).SetBytes(b[140:141]).Uint64()),
+		PoolManager:    common.BytesToAddress(b[141:161]),
+		PoolId:         common.BytesToHash(b[161:193]),
+		SqrtPriceX96:   new(big.Int).SetBytes(b[193:213]),
+		SwapBlockNum:   new(big.Int).SetBytes(b[213:221]).Uint64(),
+	}, nil
+}
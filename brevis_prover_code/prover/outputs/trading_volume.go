@@ -0,0 +1,42 @@
+// Code generated by outputgen from the TradingVolume circuit output schema. DO NOT EDIT.
+
+package outputs
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TradingVolumeSize is the length of the packed TradingVolume circuit output
+const TradingVolumeSize = 196
+
+// TradingVolumeOutput is the decoded TradingVolume circuit output
+type TradingVolumeOutput struct {
+	AccountAddr      common.Address
+	BlockNum         uint64
+	Volume           *big.Int
+	Timestamp        *big.Int
+	HistoricalVolume *big.Int
+	Token            common.Address
+	StartBlock       uint64
+	EndBlock         uint64
+}
+
+// DecodeTradingVolumeOutput decodes the packed TradingVolume circuit output
+func DecodeTradingVolumeOutput(b []byte) (*TradingVolumeOutput, error) {
+	if len(b) != TradingVolumeSize {
+		return nil, fmt.Errorf("invalid TradingVolume output length %d, expected %d", len(b), TradingVolumeSize)
+	}
+	return &TradingVolumeOutput{
+		AccountAddr:      common.BytesToAddress(b[0:32]),
+		BlockNum:         new(big.Int).SetBytes(b[32:64]).Uint64(),
+		Volume:           new(big.Int).SetBytes(b[64:96]),
+		Timestamp:        new(big.Int).SetBytes(b[96:128]),
+		HistoricalVolume: new(big.Int).SetBytes(b[128:160]),
+		Token:            common.BytesToAddress(b[160:180]),
+		StartBlock:       new(big.Int).SetBytes(b[180:188]).Uint64(),
+		EndBlock:         new(big.Int).SetBytes(b[188:196]).Uint64(),
+	}, nil
+}
@@ -0,0 +1,40 @@
+// Code generated by outputgen from the Volatility circuit output schema. DO NOT EDIT.
+
+package outputs
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// VolatilitySize is the length of the packed Volatility circuit output
+const VolatilitySize = 136
+
+// VolatilityOutput is the decoded Volatility circuit output
+type VolatilityOutput struct {
+	HistoricalVolatilityBps *big.Int
+	RelevantTimestamp       *big.Int
+	PoolManager             common.Address
+	PoolId                  common.Hash
+	FirstBlock              uint64
+	LastBlock               uint64
+	SampleCount             uint32
+}
+
+// DecodeVolatilityOutput decodes the packed Volatility circuit output
+func DecodeVolatilityOutput(b []byte) (*VolatilityOutput, error) {
+	if len(b) != VolatilitySize {
+		return nil, fmt.Errorf("invalid Volatility output length %d, expected %d", len(b), VolatilitySize)
+	}
+	return &VolatilityOutput{
+		HistoricalVolatilityBps: new(big.Int).SetBytes(b[0:32]),
+		RelevantTimestamp:       new(big.Int).SetBytes(b[32:64]),
+		PoolManager:             common.BytesToAddress(b[64:84]),
+		PoolId:                  common.BytesToHash(b[84:116]),
+		FirstBlock:              new(big.Int).SetBytes(b[116:124]).Uint64(),
+		LastBlock:               new(big.Int).SetBytes(b[124:132]).Uint64(),
+		SampleCount:             uint32(new(big.Int).SetBytes(b[132:136]).Uint64()),
+	}, nil
+}
@@ -0,0 +1,484 @@
+// Package tokens describes the ERC-20 tokens of the source chains and the
+// Uniswap v4 pools pricing them, so operators can name a pair such as
+// USDC/WETH on base instead of pasting addresses, and amounts and addresses
+// can be shown with the tokens' symbols and decimals.
+//
+// The registry is built into the prover, see registry.json, and can be
+// extended by a file of the same format. Each chain, keyed by chain id, has a
+// name, the address of its Uniswap v4 PoolManager, its tokens and its pools:
+//
+//	{
+//	  "1": {
+//	    "name": "ethereum",
+//	    "pool_manager": "0x000000000004444c5dc75cB358380D2e3dE08A90",
+//	    "tokens": [{"symbol": "USDC", "address": "0xA0b8...", "decimals": 6}],
+//	    "pools": [{"pair": "USDC/USDT", "fee": 100, "tick_spacing": 1}]
+//	  }
+//	}
+package tokens
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+var (
+	// ErrUnknownToken is returned for tokens neither the registry nor the
+	// chain knows
+	ErrUnknownToken = errors.New("unknown token")
+	// ErrUnknownChain is returned for chain names the registry does not know
+	ErrUnknownChain = errors.New("unknown chain")
+)
+
+// Token is an ERC-20 token of a chain
+type Token struct {
+	Symbol   string         `json:"symbol"`
+	Address  common.Address `json:"address"`
+	Decimals uint8          `json:"decimals"`
+}
+
+// Pool is a Uniswap v4 pool of two tokens of a chain, without native
+// currency. Its id is derived from its key.
+type Pool struct {
+	// Pair names the tokens by symbol, e.g. USDC/USDT
+	Pair        string         `json:"pair"`
+	Fee         uint32         `json:"fee"`
+	TickSpacing int32          `json:"tick_spacing"`
+	Hooks       common.Address `json:"hooks,omitempty"`
+
+	// Manager is the chain's PoolManager, Currency0 and Currency1 the pool's
+	// tokens ordered by address
+	Manager   common.Address `json:"-"`
+	Currency0 common.Address `json:"-"`
+	Currency1 common.Address `json:"-"`
+}
+
+// ID returns the pool id, the hash of the pool key
+func (p Pool) ID() common.Hash {
+	data, _ := poolKey.Pack(p.Currency0, p.Currency1, big.NewInt(int64(p.Fee)), big.NewInt(int64(p.TickSpacing)), p.Hooks)
+	return crypto.Keccak256Hash(data)
+}
+
+// Pair is a pair of tokens of a chain. Pool is the first pool of the tokens
+// in the registry, nil if it knows none.
+type Pair struct {
+	ChainId uint64
+	Token1  Token
+	Token2  Token
+	Pool    *Pool
+}
+
+// chainFile is the entry of a chain in a registry file
+type chainFile struct {
+	Name        string         `json:"name"`
+	PoolManager common.Address `json:"pool_manager"`
+	Tokens      []Token        `json:"tokens"`
+	Pools       []Pool         `json:"pools"`
+}
+
+type chain struct {
+	name        string
+	poolManager common.Address
+	tokens      map[common.Address]Token
+	// addresses of the tokens of the registry by upper case symbol
+	symbols map[string]common.Address
+	pools   []Pool
+}
+
+// Registry knows the tokens and pools of each chain. Tokens missing from it
+// can be looked up on their chain. A nil Registry knows nothing.
+type Registry struct {
+	// chains do not change once loaded
+	chains map[uint64]*chain
+	// clients of the chains tokens are looked up on, and the tokens found
+	clients  map[uint64]*ethclient.Client
+	lookedUp map[uint64]map[common.Address]Token
+	lock     sync.RWMutex
+}
+
+//go:embed registry.json
+var builtin []byte
+
+// Builtin returns the registry built into the prover
+func Builtin() *Registry {
+	r := newRegistry()
+	if err := r.add(builtin); err != nil {
+		panic(fmt.Sprintf("invalid built-in token registry: %s", err.Error()))
+	}
+	return r
+}
+
+func newRegistry() *Registry {
+	return &Registry{
+		chains:   make(map[uint64]*chain),
+		clients:  make(map[uint64]*ethclient.Client),
+		lookedUp: make(map[uint64]map[common.Address]Token),
+	}
+}
+
+// Load returns the built-in registry extended by the file at path, if path is
+// not empty. Tokens of the file replace built-in tokens with the same address
+// or symbol, and its names and pool managers replace the built-in ones.
+func Load(path string) (*Registry, error) {
+	r := Builtin()
+	if path == "" {
+		return r, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token registry: %s", err.Error())
+	}
+	if err = r.add(data); err != nil {
+		return nil, fmt.Errorf("token registry %s: %s", path, err.Error())
+	}
+	return r, nil
+}
+
+// add adds the chains of a registry file
+func (r *Registry) add(data []byte) error {
+	var chains map[uint64]chainFile
+	if err := json.Unmarshal(data, &chains); err != nil {
+		return fmt.Errorf("failed to parse: %s", err.Error())
+	}
+	ids := make([]uint64, 0, len(chains))
+	for chainId := range chains {
+		ids = append(ids, chainId)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, chainId := range ids {
+		file := chains[chainId]
+		c, ok := r.chains[chainId]
+		if !ok {
+			c = &chain{tokens: make(map[common.Address]Token), symbols: make(map[string]common.Address)}
+			r.chains[chainId] = c
+		}
+		if file.Name != "" {
+			if other, err := r.ChainID(file.Name); err == nil && other != chainId {
+				return fmt.Errorf("chain %d is named %s like chain %d", chainId, file.Name, other)
+			}
+			c.name = strings.ToLower(file.Name)
+		}
+		if file.PoolManager != (common.Address{}) {
+			c.poolManager = file.PoolManager
+		}
+
+		listed := make(map[string]bool)
+		for i, t := range file.Tokens {
+			symbol := strings.ToUpper(t.Symbol)
+			if t.Symbol == "" || t.Address == (common.Address{}) {
+				return fmt.Errorf("token %d of chain %d needs a symbol and an address", i, chainId)
+			}
+			if listed[symbol] || listed[t.Address.Hex()] {
+				return fmt.Errorf("token %s (%s) of chain %d is listed twice", t.Symbol, t.Address.Hex(), chainId)
+			}
+			listed[symbol], listed[t.Address.Hex()] = true, true
+			if old, ok := c.tokens[c.symbols[symbol]]; ok {
+				delete(c.tokens, old.Address)
+			}
+			if old, ok := c.tokens[t.Address]; ok {
+				delete(c.symbols, strings.ToUpper(old.Symbol))
+			}
+			c.tokens[t.Address] = t
+			c.symbols[symbol] = t.Address
+		}
+
+		for _, p := range file.Pools {
+			pool, err := r.pool(chainId, p)
+			if err != nil {
+				return err
+			}
+			c.pools = append(c.pools, pool)
+		}
+	}
+	return nil
+}
+
+// pool resolves the tokens of a pool of a registry file
+func (r *Registry) pool(chainId uint64, p Pool) (Pool, error) {
+	c := r.chains[chainId]
+	if c.poolManager == (common.Address{}) {
+		return Pool{}, fmt.Errorf("pool %s of chain %d needs the chain's pool_manager", p.Pair, chainId)
+	}
+	token1, token2, err := r.pairTokens(chainId, p.Pair)
+	if err != nil {
+		return Pool{}, fmt.Errorf("pool %s of chain %d: %s", p.Pair, chainId, err.Error())
+	}
+	if p.TickSpacing <= 0 || p.Fee >= 1000000 {
+		return Pool{}, fmt.Errorf("pool %s of chain %d needs a positive tick_spacing and a fee below 1000000", p.Pair, chainId)
+	}
+	p.Manager = c.poolManager
+	p.Currency0, p.Currency1 = token1.Address, token2.Address
+	if p.Currency1.Cmp(p.Currency0) < 0 {
+		p.Currency0, p.Currency1 = p.Currency1, p.Currency0
+	}
+	return p, nil
+}
+
+// ChainID returns the id of the chain with the name, e.g. base. Chain ids are
+// accepted as well.
+func (r *Registry) ChainID(name string) (uint64, error) {
+	if id, err := strconv.ParseUint(name, 10, 64); err == nil {
+		return id, nil
+	}
+	if r != nil {
+		for id, c := range r.chains {
+			if c.name == strings.ToLower(name) {
+				return id, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("%w %s", ErrUnknownChain, name)
+}
+
+// ChainName returns the name of the chain, its id if it has none
+func (r *Registry) ChainName(chainId uint64) string {
+	if r != nil {
+		if c, ok := r.chains[chainId]; ok && c.name != "" {
+			return c.name
+		}
+	}
+	return strconv.FormatUint(chainId, 10)
+}
+
+// Tokens returns the tokens of the chain's registry ordered by symbol
+func (r *Registry) Tokens(chainId uint64) []Token {
+	if r == nil || r.chains[chainId] == nil {
+		return nil
+	}
+	c := r.chains[chainId]
+	tokens := make([]Token, 0, len(c.symbols))
+	for _, addr := range c.symbols {
+		tokens = append(tokens, c.tokens[addr])
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Symbol < tokens[j].Symbol })
+	return tokens
+}
+
+// Pools returns the pools of the chain in the order they are listed
+func (r *Registry) Pools(chainId uint64) []Pool {
+	if r == nil || r.chains[chainId] == nil {
+		return nil
+	}
+	return append([]Pool(nil), r.chains[chainId].pools...)
+}
+
+// BySymbol returns the token of the chain with the symbol, ignoring case.
+// Tokens are not looked up on chain by symbol.
+func (r *Registry) BySymbol(chainId uint64, symbol string) (Token, error) {
+	if r != nil {
+		if c, ok := r.chains[chainId]; ok {
+			if addr, ok := c.symbols[strings.ToUpper(symbol)]; ok {
+				return c.tokens[addr], nil
+			}
+		}
+	}
+	return Token{}, fmt.Errorf("%w %s on chain %s", ErrUnknownToken, symbol, r.ChainName(chainId))
+}
+
+// Pair returns the tokens of a pair named by symbol, e.g. USDC/WETH, and the
+// first pool of the registry that prices one in the other
+func (r *Registry) Pair(chainId uint64, pair string) (Pair, error) {
+	token1, token2, err := r.pairTokens(chainId, pair)
+	if err != nil {
+		return Pair{}, err
+	}
+	p := Pair{ChainId: chainId, Token1: token1, Token2: token2}
+	for _, pool := range r.chains[chainId].pools {
+		if pool.Currency0 == token1.Address && pool.Currency1 == token2.Address ||
+			pool.Currency0 == token2.Address && pool.Currency1 == token1.Address {
+			p.Pool = &pool
+			break
+		}
+	}
+	return p, nil
+}
+
+// MustPair is like Pair but panics if the registry does not know the pair
+func (r *Registry) MustPair(chainId uint64, pair string) Pair {
+	p, err := r.Pair(chainId, pair)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func (r *Registry) pairTokens(chainId uint64, pair string) (Token, Token, error) {
+	symbol1, symbol2, ok := strings.Cut(pair, "/")
+	if !ok {
+		return Token{}, Token{}, fmt.Errorf("pair %q is not of the form TOKEN1/TOKEN2", pair)
+	}
+	token1, err := r.BySymbol(chainId, strings.TrimSpace(symbol1))
+	if err != nil {
+		return Token{}, Token{}, err
+	}
+	token2, err := r.BySymbol(chainId, strings.TrimSpace(symbol2))
+	if err != nil {
+		return Token{}, Token{}, err
+	}
+	if token1.Address == token2.Address {
+		return Token{}, Token{}, fmt.Errorf("pair %s has the same token twice", pair)
+	}
+	return token1, token2, nil
+}
+
+// LookupOnChain looks up tokens of the chain that are missing from the
+// registry with the RPC endpoint. Found tokens are remembered.
+func (r *Registry) LookupOnChain(chainId uint64, rpcURL string) error {
+	client, err := ethclient.Dial(rpcURL)
+	if err != nil {
+		return fmt.Errorf("failed to dial chain %d for token lookups: %s", chainId, err.Error())
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.clients[chainId] = client
+	return nil
+}
+
+// Token returns the token at the address of the chain
+func (r *Registry) Token(ctx context.Context, chainId uint64, addr common.Address) (Token, error) {
+	if r == nil {
+		return Token{}, fmt.Errorf("%w %s on chain %d", ErrUnknownToken, addr.Hex(), chainId)
+	}
+	if c, ok := r.chains[chainId]; ok {
+		if t, ok := c.tokens[addr]; ok {
+			return t, nil
+		}
+	}
+	r.lock.RLock()
+	t, ok := r.lookedUp[chainId][addr]
+	client := r.clients[chainId]
+	r.lock.RUnlock()
+	if ok {
+		return t, nil
+	}
+	if client == nil {
+		return Token{}, fmt.Errorf("%w %s on chain %d", ErrUnknownToken, addr.Hex(), chainId)
+	}
+
+	t, err := lookup(ctx, client, addr)
+	if err != nil {
+		return Token{}, fmt.Errorf("%w %s on chain %d: %s", ErrUnknownToken, addr.Hex(), chainId, err.Error())
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.lookedUp[chainId] == nil {
+		r.lookedUp[chainId] = make(map[common.Address]Token)
+	}
+	r.lookedUp[chainId][addr] = t
+	return t, nil
+}
+
+// Close closes the connections to the chains
+func (r *Registry) Close() {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, client := range r.clients {
+		client.Close()
+	}
+	r.clients = make(map[uint64]*ethclient.Client)
+}
+
+var erc20, _ = abi.JSON(strings.NewReader(`[
+	{"name": "symbol", "type": "function", "stateMutability": "view", "inputs": [], "outputs": [{"type": "string"}]},
+	{"name": "decimals", "type": "function", "stateMutability": "view", "inputs": [], "outputs": [{"type": "uint8"}]}
+]`))
+
+// poolKey is the ABI encoding of a Uniswap v4 PoolKey
+var poolKey = func() abi.Arguments {
+	address, _ := abi.NewType("address", "", nil)
+	uint24, _ := abi.NewType("uint24", "", nil)
+	int24, _ := abi.NewType("int24", "", nil)
+	return abi.Arguments{{Type: address}, {Type: address}, {Type: uint24}, {Type: int24}, {Type: address}}
+}()
+
+// lookup calls the token's symbol and decimals functions
+func lookup(ctx context.Context, client *ethclient.Client, addr common.Address) (Token, error) {
+	call := func(method string) ([]byte, error) {
+		data, _ := erc20.Pack(method)
+		result, err := client.CallContract(ctx, ethereum.CallMsg{To: &addr, Data: data}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s(): %s", method, err.Error())
+		}
+		return result, nil
+	}
+
+	t := Token{Address: addr}
+	result, err := call("decimals")
+	if err != nil {
+		return Token{}, err
+	}
+	if err = erc20.UnpackIntoInterface(&t.Decimals, "decimals", result); err != nil {
+		return Token{}, fmt.Errorf("decimals(): %s", err.Error())
+	}
+	if result, err = call("symbol"); err != nil {
+		return Token{}, err
+	}
+	if err = erc20.UnpackIntoInterface(&t.Symbol, "symbol", result); err != nil {
+		// some early tokens, e.g. MKR, return their symbol as bytes32
+		if len(result) != 32 {
+			return Token{}, fmt.Errorf("symbol(): %s", err.Error())
+		}
+		t.Symbol = string(common.TrimRightZeroes(result))
+	}
+	if t.Symbol == "" {
+		return Token{}, errors.New("symbol(): empty symbol")
+	}
+	return t, nil
+}
+
+// FormatUnits formats an amount in the smallest unit of a token as a decimal
+// number of tokens, e.g. 500000000 with 6 decimals as 500
+func FormatUnits(amount *big.Int, decimals uint8) string {
+	digits := new(big.Int).Abs(amount).String()
+	sign := ""
+	if amount.Sign() < 0 {
+		sign = "-"
+	}
+	if decimals == 0 {
+		return sign + digits
+	}
+	if len(digits) <= int(decimals) {
+		digits = strings.Repeat("0", int(decimals)-len(digits)+1) + digits
+	}
+	whole, fraction := digits[:len(digits)-int(decimals)], strings.TrimRight(digits[len(digits)-int(decimals):], "0")
+	if fraction == "" {
+		return sign + whole
+	}
+	return sign + whole + "." + fraction
+}
+
+// ParseUnits parses a decimal number of tokens, e.g. 1.5, into an amount in
+// the token's smallest unit. It is the inverse of FormatUnits.
+func ParseUnits(tokens string, decimals uint8) (*big.Int, error) {
+	whole, fraction, _ := strings.Cut(strings.TrimSpace(tokens), ".")
+	if whole+fraction == "" {
+		return nil, errors.New("empty amount")
+	}
+	if len(fraction) > int(decimals) {
+		return nil, fmt.Errorf("%s has more than %d decimals", tokens, decimals)
+	}
+	amount, ok := new(big.Int).SetString(whole+fraction+strings.Repeat("0", int(decimals)-len(fraction)), 10)
+	if !ok || strings.ContainsAny(fraction, "+-") {
+		return nil, fmt.Errorf("%q is not a decimal number", tokens)
+	}
+	return amount, nil
+}
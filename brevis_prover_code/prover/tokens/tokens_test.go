@@ -0,0 +1,214 @@
+package tokens
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var (
+	usdc = common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+	mkr  = common.HexToAddress("0x9f8F72aA9304c8B593d555F12eF6589cC3A579A2")
+)
+
+func TestLoad(t *testing.T) {
+	r, err := Load(filepath.Join("..", "configs", "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := r.Token(context.Background(), 1, usdc)
+	if err != nil || token.Symbol != "USDC" || token.Decimals != 6 {
+		t.Errorf("got %+v, %v", token, err)
+	}
+	if _, err = r.Token(context.Background(), 8453, usdc); !errors.Is(err, ErrUnknownToken) {
+		t.Errorf("expected an unknown token, got %v", err)
+	}
+	// The file adds a token and a pool to the built-in ones
+	if token, err = r.BySymbol(1, "pyusd"); err != nil || token.Decimals != 6 {
+		t.Errorf("got %+v, %v", token, err)
+	}
+	if len(r.Tokens(1)) != len(Builtin().Tokens(1))+1 || len(r.Pools(1)) != 1 {
+		t.Errorf("got tokens %+v and pools %+v", r.Tokens(1), r.Pools(1))
+	}
+
+	for name, file := range map[string]string{
+		"no symbol":     `{"1": {"tokens": [{"address": "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48", "decimals": 6}]}}`,
+		"duplicated":    `{"1": {"tokens": [{"symbol": "A", "address": "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"}, {"symbol": "B", "address": "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"}]}}`,
+		"bad chain":     `{"mainnet": {"tokens": []}}`,
+		"taken name":    `{"5": {"name": "Base"}}`,
+		"unknown token": `{"1": {"pools": [{"pair": "USDC/PEPE", "fee": 500, "tick_spacing": 10}]}}`,
+		"no manager":    `{"5": {"tokens": [{"symbol": "A", "address": "0x01"}, {"symbol": "B", "address": "0x02"}], "pools": [{"pair": "A/B", "fee": 500, "tick_spacing": 10}]}}`,
+		"bad spacing":   `{"1": {"pools": [{"pair": "USDC/USDT", "fee": 500}]}}`,
+	} {
+		path := filepath.Join(t.TempDir(), "tokens.json")
+		if err = os.WriteFile(path, []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = Load(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestPair(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	err := os.WriteFile(path, []byte(`{"8453": {"pools": [{"pair": "WETH/USDC", "fee": 500, "tick_spacing": 10}]}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := r.ChainID("Base")
+	if err != nil || base != 8453 || r.ChainName(base) != "base" {
+		t.Fatalf("got chain %d, %v", base, err)
+	}
+	if id, err := r.ChainID("11155111"); err != nil || id != 11155111 {
+		t.Errorf("got chain %d, %v", id, err)
+	}
+	if _, err = r.ChainID("solana"); !errors.Is(err, ErrUnknownChain) {
+		t.Errorf("expected an unknown chain, got %v", err)
+	}
+
+	pair, err := r.Pair(base, "usdc/weth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair.Token1.Symbol != "USDC" || pair.Token2.Decimals != 18 || pair.Pool == nil {
+		t.Fatalf("unexpected pair %+v", pair)
+	}
+	// WETH is currency 0 on base since its address is lower
+	if pair.Pool.Manager != common.HexToAddress("0x498581fF718922c3f8e6A244956aF099B2652b2b") || pair.Pool.Currency0 != pair.Token2.Address {
+		t.Errorf("unexpected pool %+v", pair.Pool)
+	}
+	if pair, err = r.Pair(base, "USDC/DAI"); err != nil || pair.Pool != nil {
+		t.Errorf("got pair %+v, %v", pair, err)
+	}
+	for _, name := range []string{"USDC", "USDC/USDC", "USDC/USDT"} {
+		if _, err = r.Pair(base, name); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestPoolID(t *testing.T) {
+	// The ETH/USDC 0.05% pool on Ethereum
+	p := Pool{Currency1: usdc, Fee: 500, TickSpacing: 10}
+	if id := p.ID().Hex(); id != "0x21c67e77068de97969ba93d4aab21826d33ca12bb9f565d8496e8fda8a82ca27" {
+		t.Errorf("got pool id %s", id)
+	}
+}
+
+// serveTokens answers eth_call with the symbol and decimals of USDC, and of MKR
+// with a bytes32 symbol
+func serveTokens(t *testing.T, calls *atomic.Int32) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage   `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Method != "eth_call" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		calls.Add(1)
+		var msg struct {
+			To    common.Address `json:"to"`
+			Input hexutil.Bytes  `json:"input"`
+		}
+		_ = json.Unmarshal(req.Params[0], &msg)
+
+		var result []byte
+		switch method := hexutil.Encode(msg.Input); {
+		case method == "0x313ce567" && msg.To == usdc:
+			result = common.LeftPadBytes([]byte{6}, 32)
+		case method == "0x313ce567" && msg.To == mkr:
+			result = common.LeftPadBytes([]byte{18}, 32)
+		case method == "0x95d89b41" && msg.To == usdc:
+			result, _ = erc20.Methods["symbol"].Outputs.Pack("USDC")
+		case method == "0x95d89b41" && msg.To == mkr:
+			result = common.RightPadBytes([]byte("MKR"), 32)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": hexutil.Encode(result)})
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestLookupOnChain(t *testing.T) {
+	var calls atomic.Int32
+	// without the built-in tokens
+	r := newRegistry()
+	defer r.Close()
+	if err := r.LookupOnChain(1, serveTokens(t, &calls)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		token, err := r.Token(ctx, 1, usdc)
+		if err != nil || token.Symbol != "USDC" || token.Decimals != 6 || token.Address != usdc {
+			t.Errorf("got %+v, %v", token, err)
+		}
+	}
+	if calls.Load() != 2 {
+		t.Errorf("expected the token to be looked up once, got %d calls", calls.Load())
+	}
+	if token, err := r.Token(ctx, 1, mkr); err != nil || token.Symbol != "MKR" || token.Decimals != 18 {
+		t.Errorf("got %+v, %v", token, err)
+	}
+	if _, err := r.Token(ctx, 1, common.HexToAddress("0x01")); !errors.Is(err, ErrUnknownToken) {
+		t.Errorf("expected an unknown token, got %v", err)
+	}
+	if _, err := r.Token(ctx, 10, usdc); !errors.Is(err, ErrUnknownToken) {
+		t.Errorf("expected an unknown token on a chain without lookups, got %v", err)
+	}
+
+	var none *Registry
+	if _, err := none.Token(ctx, 1, usdc); !errors.Is(err, ErrUnknownToken) {
+		t.Errorf("expected an unknown token, got %v", err)
+	}
+}
+
+func TestFormatUnits(t *testing.T) {
+	tests := []struct {
+		amount   string
+		decimals uint8
+		want     string
+	}{
+		{"500000000", 6, "500"},
+		{"1500000", 6, "1.5"},
+		{"1", 18, "0.000000000000000001"},
+		{"0", 6, "0"},
+		{"-2500", 3, "-2.5"},
+		{"42", 0, "42"},
+		{"123456789012345678901234567890", 18, "123456789012.34567890123456789"},
+	}
+	for _, tt := range tests {
+		amount, _ := new(big.Int).SetString(tt.amount, 10)
+		if got := FormatUnits(amount, tt.decimals); got != tt.want {
+			t.Errorf("FormatUnits(%s, %d) = %s, want %s", tt.amount, tt.decimals, got, tt.want)
+		}
+		if got, err := ParseUnits(tt.want, tt.decimals); err != nil || got.Cmp(amount) != 0 {
+			t.Errorf("ParseUnits(%s, %d) = %v, %v, want %s", tt.want, tt.decimals, got, err, tt.amount)
+		}
+	}
+	for _, tokens := range []string{"", "1.0000001", "1.-5", "1e6", "0x10"} {
+		if _, err := ParseUnits(tokens, 6); err == nil {
+			t.Errorf("ParseUnits(%q): expected an error", tokens)
+		}
+	}
+}
@@ -6,24 +6,13 @@ import {Hooks} from "v4-core/contracts/libraries/Hooks.sol";
 import {IPoolManager} from "v4-core/interfaces/IPoolManager.sol";
 import {PoolKey} from "v4-core/contracts/types/PoolKey.sol";
 import "../lib/BrevisApp.sol";
+import {TradingVolumeOutput} from "../lib/circuits/TradingVolumeOutput.sol";
 
 // Custom Errors
 error BrevisProofVerificationFailed();
 error BrevisConditionNotMet(uint256 conditionValue, uint256 threshold);
 error InvalidHookData();
 
-/**
- * @notice Struct representing the public outputs from the ZK circuit
- * @dev This must match exactly with the circuit's output structure
- */
-struct CircuitPublicInputs {
-    address accountAddr;    // The address of the account being verified
-    uint64 blockNum;       // The block number when the data was recorded
-    uint256 volume;        // The transfer volume/amount
-    uint256 timestamp;     // The timestamp of the transaction
-    uint256 historicalVolume; // Historical volume for the account
-}
-
 contract BrevisVerificationHook is BrevisApp, BaseHook {
     bytes32 public immutable requiredCircuitId; // The specific circuit ID this hook validates
     uint256 public constant MAX_ALLOWED_VOLATILITY_BPS = 100; // Example threshold: 1%
@@ -50,7 +39,9 @@ contract BrevisVerificationHook is BrevisApp, BaseHook {
     /**
      * @notice Verifies a Brevis ZK proof passed via hookData before allowing swap.
      * @dev Expects hookData to be abi.encode(bytes proof, bytes publicInputs)
-     *      The structure of publicInputs MUST match CircuitPublicInputs.
+     *      publicInputs is the TradingVolume circuit output, decoded with the
+     *      generated TradingVolumeOutput library. Its timestamp is always zero,
+     *      the circuit cannot attest timestamps; use blockNum.
      */
     function beforeSwap(
         address sender,
@@ -83,12 +74,10 @@ contract BrevisVerificationHook is BrevisApp, BaseHook {
         }
 
         // Decode and validate public inputs
-        CircuitPublicInputs memory publicInputs;
-        try abi.decode(publicInputsBytes, (CircuitPublicInputs)) returns (CircuitPublicInputs memory _pi) {
-            publicInputs = _pi;
-        } catch {
+        if (publicInputsBytes.length != TradingVolumeOutput.SIZE) {
             revert InvalidHookData();
         }
+        TradingVolumeOutput.Output memory publicInputs = TradingVolumeOutput.decodeOutput(publicInputsBytes);
 
         // Check volatility threshold
         if (publicInputs.historicalVolume > MAX_ALLOWED_VOLATILITY_BPS) {
@@ -110,7 +99,7 @@ contract BrevisVerificationHook is BrevisApp, BaseHook {
         require(_vkHash == requiredCircuitId, "Invalid circuit ID");
         
         // Decode and process the circuit output
-        CircuitPublicInputs memory inputs = abi.decode(_circuitOutput, (CircuitPublicInputs));
+        TradingVolumeOutput.Output memory inputs = TradingVolumeOutput.decodeOutput(_circuitOutput);
         
         // Additional validation can be added here if needed
         if (inputs.historicalVolume > MAX_ALLOWED_VOLATILITY_BPS) {
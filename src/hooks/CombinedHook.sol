@@ -9,15 +9,13 @@ import {PoolKey} from "@uniswap/v4-core/contracts/types/PoolKey.sol";
 import {PoolId, PoolIdLibrary} from "@uniswap/v4-core/contracts/types/PoolId.sol";
 import {TickMath} from "@uniswap/v4-core/contracts/libraries/TickMath.sol";
 import {FixedPointMathLib} from "solmate/utils/FixedPointMathLib.sol";
+// Decoder of the Volatility circuit output, generated from its output schema
+import {VolatilityOutput} from "../lib/circuits/VolatilityOutput.sol";
 
 // Brevis Imports (replace with actual)
 interface IBrevisProof {
     function verifyProof(bytes32 circuitId, bytes calldata proof, bytes calldata publicInputs) external view returns (bool);
 }
-struct YourCircuitPublicInputs { // Define based on your circuit
-    uint256 historicalVolatilityBps;
-    uint256 relevantTimestamp;
-}
 
 // --- Errors from BOTH Hook types ---
 error SwapAmountTooLargeForLiquidity(uint256 amountSpecified, uint128 currentLiquidity, uint256 maxAllowedAmount);
@@ -101,13 +99,11 @@ contract CombinedStrategyAndBrevisHook is BaseHook {
             revert BrevisProofVerificationFailed();
         }
 
-        // Decode and check public inputs
-        YourCircuitPublicInputs memory publicInputs;
-         try abi.decode(publicInputsBytes, (YourCircuitPublicInputs)) returns (YourCircuitPublicInputs memory _pi) {
-             publicInputs = _pi;
-         } catch {
-              revert InvalidHookData(); // Public inputs structure mismatch
-         }
+        // Decode and check public inputs, the Volatility circuit output
+        if (publicInputsBytes.length != VolatilityOutput.SIZE) {
+            revert InvalidHookData(); // Public inputs structure mismatch
+        }
+        VolatilityOutput.Output memory publicInputs = VolatilityOutput.decodeOutput(publicInputsBytes);
 
         // Example condition check on verified inputs
         if (publicInputs.historicalVolatilityBps > MAX_ALLOWED_VOLATILITY_BPS) {
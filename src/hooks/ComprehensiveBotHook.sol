@@ -14,17 +14,13 @@ import {Currency, CurrencyLibrary} from "@uniswap/v4-core/contracts/types/Curren
 // --- External Lib/Interface Imports ---
 // Make sure you have Solmate installed: npm install solmate
 import {FixedPointMathLib} from "solmate/utils/FixedPointMathLib.sol"; // For percentage math
+// Decoder of the Volatility circuit output, generated from its output schema
+import {VolatilityOutput} from "../lib/circuits/VolatilityOutput.sol";
 
 // !! Replace with actual Brevis interface imports from their SDK/Docs !!
 interface IBrevisProof {
     function verifyProof(bytes32 circuitId, bytes calldata proof, bytes calldata publicInputs) external view returns (bool);
 }
-// !! Define this struct based EXACTLY on your ZK circuit's public outputs !!
-struct YourCircuitPublicInputs {
-    uint256 historicalVolatilityBps; // Example
-    uint256 relevantTimestamp;       // Example
-    // Add other public outputs from your specific ZK circuit
-}
 
 // Simple Chainlink Interface (ensure it matches the feed you use)
 interface IChainlinkAggregator {
@@ -283,22 +279,21 @@ contract ComprehensiveBotHook is BaseHook {
             revert BrevisProofVerificationFailed();
         }
 
-        // Decode public inputs (structure must match YOUR circuit)
-        YourCircuitPublicInputs memory publicInputs;
-         try abi.decode(publicInputsBytes, (YourCircuitPublicInputs)) returns (YourCircuitPublicInputs memory _pi) {
-             publicInputs = _pi;
-         } catch {
-              revert InvalidHookData(); // Public inputs structure mismatch
-         }
+        // Decode public inputs, the Volatility circuit output
+        if (publicInputsBytes.length != VolatilityOutput.SIZE) {
+            revert InvalidHookData(); // Public inputs structure mismatch
+        }
+        VolatilityOutput.Output memory publicInputs = VolatilityOutput.decodeOutput(publicInputsBytes);
 
         // Check conditions based on verified public inputs
         // Example: Check proven volatility against threshold
         if (publicInputs.historicalVolatilityBps > MAX_ALLOWED_VOLATILITY_BPS) {
             revert BrevisConditionNotMet(publicInputs.historicalVolatilityBps, MAX_ALLOWED_VOLATILITY_BPS);
         }
-        // Example: Check proof freshness
-        // if (block.timestamp - publicInputs.relevantTimestamp > 1 hours) {
-        //     revert BrevisConditionNotMet(publicInputs.relevantTimestamp, block.timestamp - 1 hours); // Custom error needed
+        // Example: Check proof freshness. relevantTimestamp is always zero, the
+        // circuit cannot attest timestamps, so go by the last sampled block.
+        // if (block.number - publicInputs.lastBlock > 300) {
+        //     revert BrevisConditionNotMet(publicInputs.lastBlock, block.number - 300); // Custom error needed
         // }
     }
 
@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: MIT
+// Code generated by outputgen from the AggregatePnl circuit output schema. DO NOT EDIT.
+pragma solidity ^0.8.20;
+
+library AggregatePnlOutput {
+    uint256 internal constant SIZE = 176;
+
+    struct Output {
+        address account;
+        uint248 totalVolume;
+        uint248 pnlAmount;
+        bool isProfit;
+        uint32 tradeCount;
+        uint64 firstBlock;
+        uint64 lastBlock;
+        address token1;
+        address token2;
+        uint248 minVolume;
+        uint8 token1Decimals;
+        uint8 token2Decimals;
+    }
+
+    function decodeOutput(bytes memory o) internal pure returns (Output memory out) {
+        require(o.length == SIZE, "AggregatePnlOutput: invalid circuit output length");
+        out.account = address(bytes20(word(o, 0)));
+        out.totalVolume = uint248(bytes31(word(o, 20)));
+        out.pnlAmount = uint248(bytes31(word(o, 51)));
+        out.isProfit = uint8(o[82]) != 0;
+        out.tradeCount = uint32(bytes4(word(o, 83)));
+        out.firstBlock = uint64(bytes8(word(o, 87)));
+        out.lastBlock = uint64(bytes8(word(o, 95)));
+        out.token1 = address(bytes20(word(o, 103)));
+        out.token2 = address(bytes20(word(o, 123)));
+        out.minVolume = uint248(bytes31(word(o, 143)));
+        out.token1Decimals = uint8(bytes1(word(o, 174)));
+        out.token2Decimals = uint8(bytes1(word(o, 175)));
+    }
+
+    // word returns the 32 bytes of o at offset, which may extend past its end
+    function word(bytes memory o, uint256 offset) private pure returns (bytes32 w) {
+        assembly {
+            w := mload(add(add(o, 32), offset))
+        }
+    }
+}
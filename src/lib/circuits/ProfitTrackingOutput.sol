@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: MIT
+// Code generated by outputgen from the ProfitTracking circuit output schema. DO NOT EDIT.
+pragma solidity ^0.8.20;
+
+library ProfitTrackingOutput {
+    uint256 internal constant SIZE = 221;
+
+    struct Output {
+        uint64 buyBlockNum;
+        uint64 sellBlockNum;
+        address account;
+        uint248 pnlAmount;
+        bool isProfit;
+        address token1;
+        address token2;
+        uint248 minVolume;
+        uint8 token1Decimals;
+        uint8 token2Decimals;
+        address poolManager;
+        bytes32 poolId;
+        uint160 sqrtPriceX96;
+        uint64 swapBlockNum;
+    }
+
+    function decodeOutput(bytes memory o) internal pure returns (Output memory out) {
+        require(o.length == SIZE, "ProfitTrackingOutput: invalid circuit output length");
+        out.buyBlockNum = uint64(bytes8(word(o, 0)));
+        out.sellBlockNum = uint64(bytes8(word(o, 8)));
+        out.account = address(bytes20(word(o, 16)));
+        out.pnlAmount = uint248(bytes31(word(o, 36)));
+        out.isProfit = uint8(o[67]) != 0;
+        out.token1 = address(bytes20(word(o, 68)));
+        out.token2 = address(bytes20(word(o, 88)));
+        out.minVolume = uint248(bytes31(word(o, 108)));
+        out.token1Decimals = uint8(bytes1(word(o, 139)));
+        out.token2Decimals = uint8(bytes1(word(o, 140)));
+        out.poolManager = address(bytes20(word(o, 141)));
+        out.poolId = word(o, 161);
+        out.sqrtPriceX96 = uint160(bytes20(word(o, 193)));
+        out.swapBlockNum = uint64(bytes8(word(o, 213)));
+    }
+
+    // word returns the 32 bytes of o at offset, which may extend past its end
+    function word(bytes memory o, uint256 offset) private pure returns (bytes32 w) {
+        assembly {
+            w := mload(add(add(o, 32), offset))
+        }
+    }
+}
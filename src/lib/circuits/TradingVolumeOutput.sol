@@ -0,0 +1,37 @@
+// SPDX-License-Identifier: MIT
+// Code generated by outputgen from the TradingVolume circuit output schema. DO NOT EDIT.
+pragma solidity ^0.8.20;
+
+library TradingVolumeOutput {
+    uint256 internal constant SIZE = 196;
+
+    struct Output {
+        address accountAddr;
+        uint64 blockNum;
+        uint256 volume;
+        uint256 timestamp;
+        uint256 historicalVolume;
+        address token;
+        uint64 startBlock;
+        uint64 endBlock;
+    }
+
+    function decodeOutput(bytes memory o) internal pure returns (Output memory out) {
+        require(o.length == SIZE, "TradingVolumeOutput: invalid circuit output length");
+        out.accountAddr = address(uint160(uint256(word(o, 0))));
+        out.blockNum = uint64(uint256(word(o, 32)));
+        out.volume = uint256(bytes32(word(o, 64)));
+        out.timestamp = uint256(bytes32(word(o, 96)));
+        out.historicalVolume = uint256(bytes32(word(o, 128)));
+        out.token = address(bytes20(word(o, 160)));
+        out.startBlock = uint64(bytes8(word(o, 180)));
+        out.endBlock = uint64(bytes8(word(o, 188)));
+    }
+
+    // word returns the 32 bytes of o at offset, which may extend past its end
+    function word(bytes memory o, uint256 offset) private pure returns (bytes32 w) {
+        assembly {
+            w := mload(add(add(o, 32), offset))
+        }
+    }
+}
@@ -0,0 +1,35 @@
+// SPDX-License-Identifier: MIT
+// Code generated by outputgen from the Volatility circuit output schema. DO NOT EDIT.
+pragma solidity ^0.8.20;
+
+library VolatilityOutput {
+    uint256 internal constant SIZE = 136;
+
+    struct Output {
+        uint256 historicalVolatilityBps;
+        uint256 relevantTimestamp;
+        address poolManager;
+        bytes32 poolId;
+        uint64 firstBlock;
+        uint64 lastBlock;
+        uint32 sampleCount;
+    }
+
+    function decodeOutput(bytes memory o) internal pure returns (Output memory out) {
+        require(o.length == SIZE, "VolatilityOutput: invalid circuit output length");
+        out.historicalVolatilityBps = uint256(bytes32(word(o, 0)));
+        out.relevantTimestamp = uint256(bytes32(word(o, 32)));
+        out.poolManager = address(bytes20(word(o, 64)));
+        out.poolId = word(o, 84);
+        out.firstBlock = uint64(bytes8(word(o, 116)));
+        out.lastBlock = uint64(bytes8(word(o, 124)));
+        out.sampleCount = uint32(bytes4(word(o, 132)));
+    }
+
+    // word returns the 32 bytes of o at offset, which may extend past its end
+    function word(bytes memory o, uint256 offset) private pure returns (bytes32 w) {
+        assembly {
+            w := mload(add(add(o, 32), offset))
+        }
+    }
+}